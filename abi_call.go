@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+var bigIntType = reflect.TypeOf(&big.Int{})
+
+// encodeContractCall packs the method and args of a sign request with its
+// registered contract ABI into the data field. It returns the decoded call to
+// echo in the response, or nil when the request carries raw data.
+func encodeContractCall(ctx context.Context, s logical.Storage, data *framework.FieldData) (map[string]interface{}, error) {
+	rawMethod, ok := data.GetOk("method")
+	if !ok {
+		return nil, nil
+	}
+	if data.Get("data").(string) != Empty {
+		return nil, errors.New("data and method are mutually exclusive")
+	}
+	if _, deploy := data.GetOk("bytecode"); deploy {
+		return nil, errors.New("bytecode and method are mutually exclusive")
+	}
+
+	name := data.Get("contract_abi").(string)
+	if name == Empty {
+		return nil, errors.New("contract_abi not specified")
+	}
+	contractABI, err := readContractABI(ctx, s, name)
+	if err != nil {
+		return nil, err
+	}
+	if contractABI == nil {
+		return nil, fmt.Errorf("unknown ABI %s", name)
+	}
+	parsed, err := contractABI.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	method, err := findMethod(parsed, rawMethod.(string))
+	if err != nil {
+		return nil, err
+	}
+
+	args, err := parseABIArgs(method.Inputs, data.Get("args").(string))
+	if err != nil {
+		return nil, fmt.Errorf("invalid args for %s: %v", method.Sig, err)
+	}
+	packed, err := method.Inputs.Pack(args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack %s: %v", method.Sig, err)
+	}
+	input := append(append([]byte{}, method.ID...), packed...)
+	data.Raw["data"] = hex.EncodeToString(input)
+
+	call, err := decodeCall(method, input)
+	if err != nil {
+		return nil, err
+	}
+	call["contract_abi"] = name
+	return call, nil
+}
+
+// findMethod looks a method up by name, or by signature for overloaded methods
+func findMethod(parsed abi.ABI, name string) (*abi.Method, error) {
+	if strings.Contains(name, "(") {
+		signature := strings.ReplaceAll(name, " ", Empty)
+		for _, method := range parsed.Methods {
+			if method.Sig == signature {
+				method := method
+				return &method, nil
+			}
+		}
+		return nil, fmt.Errorf("method %s is not defined in the ABI", name)
+	}
+	method, ok := parsed.Methods[name]
+	if !ok {
+		return nil, fmt.Errorf("method %s is not defined in the ABI", name)
+	}
+	return &method, nil
+}
+
+// decodeCall renders calldata in a human readable form
+func decodeCall(method *abi.Method, input []byte) (map[string]interface{}, error) {
+	if len(input) < 4 || !bytes.Equal(input[:4], method.ID) {
+		return nil, fmt.Errorf("calldata does not match %s", method.Sig)
+	}
+	values, err := method.Inputs.Unpack(input[4:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", method.Sig, err)
+	}
+
+	args := make([]map[string]interface{}, len(values))
+	for i, value := range values {
+		args[i] = map[string]interface{}{
+			"name":  argumentName(method.Inputs[i].Name, i),
+			"type":  method.Inputs[i].Type.String(),
+			"value": formatABIValue(method.Inputs[i].Type, reflect.ValueOf(value)),
+		}
+	}
+
+	return map[string]interface{}{
+		"method":   method.Sig,
+		"selector": hexutil.Encode(method.ID),
+		"args":     args,
+	}, nil
+}
+
+func argumentName(name string, i int) string {
+	if name == Empty {
+		return fmt.Sprintf("arg%d", i)
+	}
+	return name
+}
+
+// parseABIArgs converts JSON args, either a list or an object keyed by
+// argument name, into the Go values expected by the ABI packer
+func parseABIArgs(arguments abi.Arguments, raw string) ([]interface{}, error) {
+	var decoded interface{}
+	if raw != Empty {
+		decoder := json.NewDecoder(strings.NewReader(raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&decoded); err != nil {
+			return nil, err
+		}
+	}
+
+	var list []interface{}
+	switch v := decoded.(type) {
+	case nil:
+	case []interface{}:
+		list = v
+	case map[string]interface{}:
+		for i, argument := range arguments {
+			value, ok := v[argumentName(argument.Name, i)]
+			if !ok {
+				return nil, fmt.Errorf("missing argument %s", argumentName(argument.Name, i))
+			}
+			list = append(list, value)
+		}
+		if len(v) != len(arguments) {
+			return nil, fmt.Errorf("expected %d arguments, got %d", len(arguments), len(v))
+		}
+	default:
+		return nil, errors.New("args must be a JSON list or object")
+	}
+	if len(list) != len(arguments) {
+		return nil, fmt.Errorf("expected %d arguments, got %d", len(arguments), len(list))
+	}
+
+	values := make([]interface{}, len(list))
+	for i, argument := range arguments {
+		value, err := abiValue(argument.Type, list[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", argumentName(argument.Name, i), err)
+		}
+		values[i] = value.Interface()
+	}
+	return values, nil
+}
+
+// abiValue converts a decoded JSON value into the Go type used by the ABI
+// packer for t. Integers may be JSON numbers, decimal or 0x hex strings.
+func abiValue(t abi.Type, raw interface{}) (reflect.Value, error) {
+	goType := t.GetType()
+
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		n, err := abiInteger(raw)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if !integerFits(t, n) {
+			return reflect.Value{}, fmt.Errorf("%s overflows %s", n, t)
+		}
+		if goType == bigIntType {
+			return reflect.ValueOf(n), nil
+		}
+		value := reflect.New(goType).Elem()
+		if t.T == abi.UintTy {
+			value.SetUint(n.Uint64())
+		} else {
+			value.SetInt(n.Int64())
+		}
+		return value, nil
+	case abi.BoolTy:
+		b, ok := raw.(bool)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected a bool for %s", t)
+		}
+		return reflect.ValueOf(b), nil
+	case abi.StringTy:
+		str, ok := raw.(string)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected a string for %s", t)
+		}
+		return reflect.ValueOf(str), nil
+	case abi.AddressTy:
+		str, ok := raw.(string)
+		if !ok || !common.IsHexAddress(str) {
+			return reflect.Value{}, fmt.Errorf("invalid address %v", raw)
+		}
+		return reflect.ValueOf(common.HexToAddress(str)), nil
+	case abi.BytesTy, abi.FixedBytesTy:
+		str, ok := raw.(string)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected hex for %s", t)
+		}
+		decoded, err := hexutil.Decode(str)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid hex for %s: %v", t, err)
+		}
+		if t.T == abi.BytesTy {
+			return reflect.ValueOf(decoded), nil
+		}
+		if len(decoded) != t.Size {
+			return reflect.Value{}, fmt.Errorf("expected %d bytes for %s, got %d", t.Size, t, len(decoded))
+		}
+		value := reflect.New(goType).Elem()
+		reflect.Copy(value, reflect.ValueOf(decoded))
+		return value, nil
+	case abi.SliceTy, abi.ArrayTy:
+		list, ok := raw.([]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected a list for %s", t)
+		}
+		var value reflect.Value
+		if t.T == abi.SliceTy {
+			value = reflect.MakeSlice(goType, len(list), len(list))
+		} else {
+			if len(list) != t.Size {
+				return reflect.Value{}, fmt.Errorf("expected %d elements for %s, got %d", t.Size, t, len(list))
+			}
+			value = reflect.New(goType).Elem()
+		}
+		for i, item := range list {
+			elem, err := abiValue(*t.Elem, item)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("[%d]: %v", i, err)
+			}
+			value.Index(i).Set(elem)
+		}
+		return value, nil
+	case abi.TupleTy:
+		value := reflect.New(goType).Elem()
+		for i, elem := range t.TupleElems {
+			var item interface{}
+			switch v := raw.(type) {
+			case []interface{}:
+				if len(v) != len(t.TupleElems) {
+					return reflect.Value{}, fmt.Errorf("expected %d fields for %s, got %d", len(t.TupleElems), t, len(v))
+				}
+				item = v[i]
+			case map[string]interface{}:
+				var ok bool
+				if item, ok = v[t.TupleRawNames[i]]; !ok {
+					return reflect.Value{}, fmt.Errorf("missing field %s", t.TupleRawNames[i])
+				}
+			default:
+				return reflect.Value{}, fmt.Errorf("expected a list or an object for %s", t)
+			}
+			field, err := abiValue(*elem, item)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("%s: %v", t.TupleRawNames[i], err)
+			}
+			value.Field(i).Set(field)
+		}
+		return value, nil
+	default:
+		return reflect.Value{}, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+func abiInteger(raw interface{}) (*big.Int, error) {
+	var str string
+	switch v := raw.(type) {
+	case json.Number:
+		str = v.String()
+	case string:
+		str = v
+	default:
+		return nil, fmt.Errorf("expected an integer, got %v", raw)
+	}
+
+	base := 10
+	if strings.HasPrefix(str, "0x") {
+		str, base = str[2:], 16
+	}
+	n, ok := new(big.Int).SetString(str, base)
+	if !ok {
+		return nil, fmt.Errorf("invalid integer %s", str)
+	}
+	return n, nil
+}
+
+// integerFits reports whether n is in the range of the integer type t
+func integerFits(t abi.Type, n *big.Int) bool {
+	if t.T == abi.UintTy {
+		return n.Sign() >= 0 && n.BitLen() <= t.Size
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(t.Size-1))
+	return n.Cmp(new(big.Int).Neg(limit)) >= 0 && n.Cmp(limit) < 0
+}
+
+// formatABIValue renders an unpacked ABI value with JSON friendly types:
+// integers as decimal strings and bytes as hex
+func formatABIValue(t abi.Type, value reflect.Value) interface{} {
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		if value.Type() == bigIntType {
+			return value.Interface().(*big.Int).String()
+		}
+		if t.T == abi.UintTy {
+			return new(big.Int).SetUint64(value.Uint()).String()
+		}
+		return big.NewInt(value.Int()).String()
+	case abi.AddressTy:
+		return value.Interface().(common.Address).Hex()
+	case abi.BytesTy:
+		return hexutil.Encode(value.Bytes())
+	case abi.FixedBytesTy, abi.HashTy:
+		raw := make([]byte, value.Len())
+		reflect.Copy(reflect.ValueOf(raw), value)
+		return hexutil.Encode(raw)
+	case abi.SliceTy, abi.ArrayTy:
+		items := make([]interface{}, value.Len())
+		for i := range items {
+			items[i] = formatABIValue(*t.Elem, value.Index(i))
+		}
+		return items
+	case abi.TupleTy:
+		fields := make(map[string]interface{}, len(t.TupleElems))
+		for i, elem := range t.TupleElems {
+			fields[t.TupleRawNames[i]] = formatABIValue(*elem, value.Field(i))
+		}
+		return fields
+	default:
+		return value.Interface()
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// testTokenABI is an ERC-20 ABI with an overloaded safeTransfer
+const testTokenABI = `[
+	{"type": "function", "name": "transfer", "inputs": [{"name": "to", "type": "address"}, {"name": "amount", "type": "uint256"}], "outputs": [{"name": "", "type": "bool"}]},
+	{"type": "function", "name": "approve", "inputs": [{"name": "spender", "type": "address"}, {"name": "amount", "type": "uint256"}], "outputs": [{"name": "", "type": "bool"}]},
+	{"type": "function", "name": "safeTransfer", "inputs": [{"name": "to", "type": "address"}, {"name": "amount", "type": "uint256"}]},
+	{"type": "function", "name": "safeTransfer", "inputs": [{"name": "to", "type": "address"}, {"name": "amount", "type": "uint256"}, {"name": "data", "type": "bytes"}]}
+]`
+
+// testTransferData is the calldata of transfer(testRecipient, 1000)
+const testTransferData = "0xa9059cbb00000000000000000000000070997970c51812dc3a010c7d01b50e0d17dc79c800000000000000000000000000000000000000000000000000000000000003e8"
+
+// registerTestABI registers testTokenABI as token
+func registerTestABI(t *testing.T, b *vaultEthereumBackend, s logical.Storage) {
+	t.Helper()
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "abis/token", map[string]interface{}{
+		"abi":         testTokenABI,
+		"description": "ERC-20",
+	}))
+}
+
+func TestABIRegistry(t *testing.T) {
+	b, s := getTestBackend(t)
+	registerTestABI(t, b, s)
+
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "abis/token", nil))
+	methods := resp.Data["methods"].(map[string]string)
+	if methods["transfer(address,uint256)"] != "0xa9059cbb" || len(methods) != 4 {
+		t.Fatalf("unexpected methods %v", methods)
+	}
+	resp = mustSucceed(t, request(t, b, s, logical.ListOperation, "abis/", nil))
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"token"}) {
+		t.Fatalf("expected token to be listed, got %v", resp.Data["keys"])
+	}
+
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "abis/broken", map[string]interface{}{"abi": "[{"}))
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "abis/empty", map[string]interface{}{"description": "no abi"}))
+
+	request(t, b, s, logical.DeleteOperation, "abis/token", nil)
+	if resp := request(t, b, s, logical.ReadOperation, "abis/token", nil); resp != nil {
+		t.Fatalf("expected the ABI to be deleted, got %v", resp.Data)
+	}
+}
+
+func TestSignTxEncodesContractCall(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	registerTestABI(t, b, s)
+
+	for _, args := range []string{
+		`["0x70997970C51812dc3A010C7d01b50e0d17dc79C8", 1000]`,
+		`{"to": "0x70997970C51812dc3A010C7d01b50e0d17dc79C8", "amount": "1000"}`,
+	} {
+		resp := signTx(t, b, s, "test", "0", map[string]interface{}{
+			"to":           testAddress,
+			"gas_limit":    "60000",
+			"contract_abi": "token",
+			"method":       "transfer",
+			"args":         args,
+		})
+		if tx := signedTransaction(t, resp); hexutil.Encode(tx.Data()) != testTransferData {
+			t.Fatalf("args %s: unexpected calldata %x", args, tx.Data())
+		}
+		call := resp.Data["call"].(map[string]interface{})
+		if call["method"] != "transfer(address,uint256)" || call["selector"] != "0xa9059cbb" || call["contract_abi"] != "token" {
+			t.Fatalf("unexpected call %v", call)
+		}
+	}
+
+	resp := signTx(t, b, s, "test", "0", map[string]interface{}{
+		"to":           testAddress,
+		"gas_limit":    "60000",
+		"contract_abi": "token",
+		"method":       "safeTransfer(address, uint256, bytes)",
+		"args":         `["0x70997970C51812dc3A010C7d01b50e0d17dc79C8", 1, "0x01"]`,
+	})
+	if call := mustSucceed(t, resp).Data["call"].(map[string]interface{}); call["method"] != "safeTransfer(address,uint256,bytes)" {
+		t.Fatalf("expected the overload with bytes, got %v", call["method"])
+	}
+}
+
+func TestSignTxRejectsInvalidContractCalls(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	registerTestABI(t, b, s)
+
+	for _, c := range []struct {
+		data map[string]interface{}
+		err  string
+	}{
+		{map[string]interface{}{"method": "transfer"}, "contract_abi not specified"},
+		{map[string]interface{}{"contract_abi": "missing", "method": "transfer"}, "unknown ABI"},
+		{map[string]interface{}{"contract_abi": "token", "method": "mint"}, "not defined"},
+		{map[string]interface{}{"contract_abi": "token", "method": "safeTransfer(address)"}, "not defined"},
+		{map[string]interface{}{"contract_abi": "token", "method": "transfer", "args": `["0x70997970C51812dc3A010C7d01b50e0d17dc79C8"]`}, "expected 2 arguments"},
+		{map[string]interface{}{"contract_abi": "token", "method": "transfer", "args": `["nope", 1]`}, "invalid address"},
+		{map[string]interface{}{"contract_abi": "token", "method": "transfer", "args": `["0x70997970C51812dc3A010C7d01b50e0d17dc79C8", -1]`}, "overflows"},
+		{map[string]interface{}{"contract_abi": "token", "method": "transfer", "data": "0x01"}, "mutually exclusive"},
+	} {
+		c.data["to"] = testAddress
+		resp := mustFail(t, signTx(t, b, s, "test", "0", c.data))
+		if !strings.Contains(resp.Error().Error(), c.err) {
+			t.Fatalf("%v: expected an error containing %q, got %v", c.data, c.err, resp.Error())
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pborman/uuid"
+)
+
+const (
+	// DefaultApprovalTTL is how long a request waits for approvals when the
+	// policy does not set approval_ttl
+	DefaultApprovalTTL = 24 * time.Hour
+
+	// RequestStatusPending is a request waiting for approvals
+	RequestStatusPending string = "pending"
+	// RequestStatusReleased is a request that reached quorum and was signed
+	RequestStatusReleased string = "released"
+)
+
+// Approval records a Vault entity approving a request
+type Approval struct {
+	EntityID    string    `json:"entity_id"`
+	DisplayName string    `json:"display_name,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// ApprovalRequest is a transaction waiting for M-of-N approvals before it is
+// signed
+type ApprovalRequest struct {
+	ID                string     `json:"id"`
+	Account           string     `json:"account"`
+	ChainID           int64      `json:"chain_id"`
+	Transaction       string     `json:"transaction"`
+	NonceSet          bool       `json:"nonce_set"`
+	RequestedBy       string     `json:"requested_by,omitempty"`
+	RequestedAt       time.Time  `json:"requested_at"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	RequiredApprovals int        `json:"required_approvals"`
+	Approvals         []Approval `json:"approvals,omitempty"`
+	Status            string     `json:"status"`
+	SignedTransaction string     `json:"signed_transaction,omitempty"`
+}
+
+func requestPath(id string) string {
+	return QualifiedPath(fmt.Sprintf("requests/%s", id))
+}
+
+func readApprovalRequest(ctx context.Context, s logical.Storage, id string) (*ApprovalRequest, error) {
+	entry, err := s.Get(ctx, requestPath(id))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var request ApprovalRequest
+	if err := entry.DecodeJSON(&request); err != nil {
+		return nil, fmt.Errorf("failed to deserialize request %s: %v", id, err)
+	}
+	return &request, nil
+}
+
+func writeApprovalRequest(ctx context.Context, s logical.Storage, request *ApprovalRequest) error {
+	entry, err := logical.StorageEntryJSON(requestPath(request.ID), request)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// requiresApproval reports whether the policy holds tx for approvals. ERC-20
+// transfers and approvals are held when their amount exceeds the threshold of
+// their token, or always when the token has no threshold. Without
+// a threshold every transaction needs approvals.
+func (policy *AccountPolicy) requiresApproval(tx *types.Transaction) bool {
+	if policy == nil || policy.RequiredApprovals <= 0 {
+		return false
+	}
+	if policy.ApprovalThreshold == Empty {
+		return true
+	}
+	threshold, _ := new(big.Int).SetString(policy.ApprovalThreshold, 10)
+	if tx.Value().Cmp(threshold) > 0 {
+		return true
+	}
+	if _, amount := erc20Amount(tx.Data()); amount != nil && tx.To() != nil {
+		rawThreshold, ok := policy.TokenApprovalThresholds[tx.To().Hex()]
+		if !ok {
+			return true
+		}
+		tokenThreshold, _ := new(big.Int).SetString(rawThreshold, 10)
+		return amount.Cmp(tokenThreshold) > 0
+	}
+	return false
+}
+
+// canApprove reports whether an entity is one of the approvers of the policy.
+// Any entity may approve when no approvers are listed.
+func (policy *AccountPolicy) canApprove(entityID string) bool {
+	if len(policy.Approvers) == 0 {
+		return true
+	}
+	for _, approver := range policy.Approvers {
+		if approver == entityID {
+			return true
+		}
+	}
+	return false
+}
+
+// createApprovalRequest stores tx as a pending request and returns its
+// description to the requester
+func (b *vaultEthereumBackend) createApprovalRequest(ctx context.Context, req *logical.Request, name string, policy *AccountPolicy, chainID *big.Int, tx *types.Transaction, nonceSet bool) (*logical.Response, error) {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := policy.ApprovalTTL
+	if ttl <= 0 {
+		ttl = DefaultApprovalTTL
+	}
+	now := time.Now().UTC()
+	request := &ApprovalRequest{
+		ID:                uuid.New(),
+		Account:           name,
+		ChainID:           chainID.Int64(),
+		Transaction:       hexutil.Encode(raw),
+		NonceSet:          nonceSet,
+		RequestedBy:       req.EntityID,
+		RequestedAt:       now,
+		ExpiresAt:         now.Add(ttl),
+		RequiredApprovals: policy.RequiredApprovals,
+		Status:            RequestStatusPending,
+	}
+
+	b.requestLock.Lock()
+	defer b.requestLock.Unlock()
+	if err := writeApprovalRequest(ctx, req.Storage, request); err != nil {
+		return nil, err
+	}
+	return approvalRequestResponse(ctx, req.Storage, request)
+}
+
+// transaction decodes the unsigned transaction of the request
+func (request *ApprovalRequest) transaction() (*types.Transaction, error) {
+	raw, err := hexutil.Decode(request.Transaction)
+	if err != nil {
+		return nil, err
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("failed to decode the transaction of request %s: %v", request.ID, err)
+	}
+	return tx, nil
+}
+
+// approvalRequestResponse describes a request, decoding its transaction so
+// approvers can see what they approve
+func approvalRequestResponse(ctx context.Context, s logical.Storage, request *ApprovalRequest) (*logical.Response, error) {
+	tx, err := request.transaction()
+	if err != nil {
+		return nil, err
+	}
+	index, err := loadSelectorIndex(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	approvals := make([]map[string]interface{}, len(request.Approvals))
+	for i, approval := range request.Approvals {
+		approvals[i] = map[string]interface{}{
+			"entity_id":    approval.EntityID,
+			"display_name": approval.DisplayName,
+			"time":         approval.Time.Format(time.RFC3339),
+		}
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"request_id":         request.ID,
+			"status":             request.Status,
+			"account":            request.Account,
+			"chain_id":           request.ChainID,
+			"requested_by":       request.RequestedBy,
+			"requested_at":       request.RequestedAt.Format(time.RFC3339),
+			"expires_at":         request.ExpiresAt.Format(time.RFC3339),
+			"required_approvals": request.RequiredApprovals,
+			"approvals":          approvals,
+			"transaction":        describeTransaction(tx, request.NonceSet, index),
+		},
+	}
+	if request.SignedTransaction != Empty {
+		resp.Data["rlpSignature"] = request.SignedTransaction
+	}
+	return resp, nil
+}
+
+// describeTransaction renders an unsigned transaction in a human readable
+// form, decoding its calldata against the registered ABIs
+func describeTransaction(tx *types.Transaction, nonceSet bool, index selectorIndex) map[string]interface{} {
+	description := map[string]interface{}{
+		"type":  tx.Type(),
+		"value": tx.Value().String(),
+		"gas":   tx.Gas(),
+		"data":  hexutil.Encode(tx.Data()),
+	}
+	if tx.To() != nil {
+		description["to"] = tx.To().Hex()
+	}
+	if nonceSet {
+		description["nonce"] = tx.Nonce()
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		description["max_fee_per_gas"] = tx.GasFeeCap().String()
+		description["max_priority_fee_per_gas"] = tx.GasTipCap().String()
+	} else {
+		description["gas_price"] = tx.GasPrice().String()
+	}
+	if len(tx.Data()) >= 4 && tx.To() != nil {
+		if _, _, method := index.decode(tx.Data()); method != nil {
+			if call, err := decodeCall(method, tx.Data()); err == nil {
+				description["call"] = call
+			}
+		}
+	}
+	return description
+}
+
+// purgeExpiredRequests deletes the requests whose approval window is over
+func (b *vaultEthereumBackend) purgeExpiredRequests(ctx context.Context, s logical.Storage) error {
+	b.requestLock.Lock()
+	defer b.requestLock.Unlock()
+
+	ids, err := s.List(ctx, QualifiedPath("requests/"))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, id := range ids {
+		request, err := readApprovalRequest(ctx, s, id)
+		if err != nil {
+			return err
+		}
+		if request != nil && now.After(request.ExpiresAt) {
+			if err := s.Delete(ctx, requestPath(id)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
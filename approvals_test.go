@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// writePolicy updates the policy of the account test
+func writePolicy(t *testing.T, b *vaultEthereumBackend, s logical.Storage, data map[string]interface{}) {
+	t.Helper()
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", data))
+}
+
+// approve approves the request id as entity
+func approve(t *testing.T, b *vaultEthereumBackend, s logical.Storage, entity string, id string) *logical.Response {
+	t.Helper()
+	return requestAs(t, b, s, entity, logical.UpdateOperation, "requests/"+id+"/approve", map[string]interface{}{})
+}
+
+// heldRequest returns the ID of the approval request a sign response holds
+func heldRequest(t *testing.T, resp *logical.Response) string {
+	t.Helper()
+	mustSucceed(t, resp)
+	if resp.Data["rlpSignature"] != nil {
+		t.Fatal("expected the transaction to be held for approvals")
+	}
+	if resp.Data["status"] != RequestStatusPending {
+		t.Fatalf("expected a pending request, got %v", resp.Data["status"])
+	}
+	return resp.Data["request_id"].(string)
+}
+
+// transferCalldata encodes an ERC-20 transfer of amount base units
+func transferCalldata(t *testing.T, amount int64) string {
+	t.Helper()
+	input, err := erc20ABI.Pack("transfer", common.HexToAddress(testOther), big.NewInt(amount))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(input)
+}
+
+func TestApprovals(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	writePolicy(t, b, s, map[string]interface{}{
+		"approval_threshold": "100",
+		"required_approvals": 2,
+		"approvers":          "entity-1,entity-2,entity-3",
+	})
+
+	mustSucceed(t, signTx(t, b, s, "test", "100", nil))
+	id := heldRequest(t, signTx(t, b, s, "test", "101", nil))
+
+	mustFail(t, approve(t, b, s, testEntity, id))
+	mustFail(t, approve(t, b, s, "entity-9", id))
+	resp := mustSucceed(t, approve(t, b, s, "entity-1", id))
+	if resp.Data["status"] != RequestStatusPending || resp.Data["rlpSignature"] != nil {
+		t.Fatalf("expected the request to wait for a second approval, got %v", resp.Data)
+	}
+	mustFail(t, approve(t, b, s, "entity-1", id))
+
+	tx := signedTransaction(t, approve(t, b, s, "entity-2", id))
+	if tx.Value().Cmp(big.NewInt(101)) != 0 {
+		t.Fatalf("expected the held transaction, got value %s", tx.Value())
+	}
+	mustFail(t, approve(t, b, s, "entity-3", id))
+
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "requests/"+id, nil))
+	if resp.Data["status"] != RequestStatusReleased || resp.Data["rlpSignature"] == nil {
+		t.Fatalf("expected a released request, got %v", resp.Data)
+	}
+}
+
+func TestApprovalsAllocateNonceOnRelease(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	writePolicy(t, b, s, map[string]interface{}{"required_approvals": 1})
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/nonces/1", map[string]interface{}{
+		"next": 4,
+	}))
+
+	id := heldRequest(t, signTx(t, b, s, "test", "1", map[string]interface{}{"nonce": nil}))
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/test/nonces/1", nil))
+	if resp.Data["next"] != uint64(4) {
+		t.Fatalf("expected no nonce to be allocated while held, got next %v", resp.Data["next"])
+	}
+	if tx := signedTransaction(t, approve(t, b, s, "entity-1", id)); tx.Nonce() != 4 {
+		t.Fatalf("expected nonce 4, got %d", tx.Nonce())
+	}
+}
+
+func TestApprovalsRecheckPolicyOnRelease(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	writePolicy(t, b, s, map[string]interface{}{"required_approvals": 1})
+	id := heldRequest(t, signTx(t, b, s, "test", "500", nil))
+
+	writePolicy(t, b, s, map[string]interface{}{"max_value": "100"})
+	if rule := violatedRule(t, approve(t, b, s, "entity-1", id)); rule != RuleMaxValue {
+		t.Fatalf("expected rule %s, got %s", RuleMaxValue, rule)
+	}
+}
+
+func TestApprovalsTokenThresholds(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "config/tokens/usdc", map[string]interface{}{
+		"address":  testToken,
+		"decimals": 6,
+	}))
+	writePolicy(t, b, s, map[string]interface{}{
+		"approval_threshold":        "1000000000000000000",
+		"token_approval_thresholds": map[string]interface{}{"usdc": "100"},
+		"required_approvals":        1,
+	})
+
+	mustSucceed(t, signCall(t, b, s, testToken, map[string]interface{}{"data": transferCalldata(t, 100000000)}))
+	heldRequest(t, signCall(t, b, s, testToken, map[string]interface{}{"data": transferCalldata(t, 100000001)}))
+	heldRequest(t, signCall(t, b, s, testOther, map[string]interface{}{"data": transferCalldata(t, 1)}))
+	mustSucceed(t, signTx(t, b, s, "test", "1000", nil))
+}
+
+func TestApprovalsExpire(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	writePolicy(t, b, s, map[string]interface{}{"required_approvals": 1})
+	ctx := context.Background()
+
+	expired := heldRequest(t, signTx(t, b, s, "test", "1", nil))
+	pending := heldRequest(t, signTx(t, b, s, "test", "1", nil))
+	request, err := readApprovalRequest(ctx, s, expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.ExpiresAt = time.Now().Add(-time.Second)
+	if err := writeApprovalRequest(ctx, s, request); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.purgeExpiredRequests(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := s.List(ctx, "requests/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != pending {
+		t.Fatalf("expected only request %s to remain, got %v", pending, ids)
+	}
+	mustFail(t, approve(t, b, s, "entity-1", expired))
+}
+
+func TestApprovalsCancel(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	writePolicy(t, b, s, map[string]interface{}{"required_approvals": 1})
+
+	id := heldRequest(t, signTx(t, b, s, "test", "1", nil))
+	resp := mustSucceed(t, request(t, b, s, logical.ListOperation, "requests/", nil))
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != id {
+		t.Fatalf("expected request %s to be listed, got %v", id, keys)
+	}
+
+	request(t, b, s, logical.DeleteOperation, "requests/"+id, nil)
+	mustFail(t, approve(t, b, s, "entity-1", id))
+}
+
+func TestApprovalsRejectInvalidPolicy(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	for _, data := range []map[string]interface{}{
+		{"approval_threshold": "-1"},
+		{"required_approvals": -1},
+		{"required_approvals": 3, "approvers": "entity-1,entity-2"},
+		{"token_approval_thresholds": "usdc=1"},
+	} {
+		mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", data))
+	}
+}
@@ -25,6 +25,12 @@ import (
 type vaultEthereumBackend struct {
 	*framework.Backend
 	lock sync.RWMutex
+
+	// requestLock serializes the updates of approval requests
+	requestLock sync.Mutex
+
+	// newClient connects to the JSON-RPC endpoint of a chain
+	newClient func(ctx context.Context, rpcURL string) (ethClient, error)
 }
 
 // Factory returns the backend
@@ -54,18 +60,64 @@ func backend() *vaultEthereumBackend {
 		Help: "",
 		Paths: framework.PathAppend(
 			accountPaths(&b),
+			disablePaths(&b, accountPattern, accountIdentity),
+			deletedAccountPaths(&b),
+			deletedWalletPaths(&b),
+			rotatePaths(&b),
+			exportPaths(&b),
+			policyPaths(&b, accountPattern, accountIdentity),
+			spendingPaths(&b, accountPattern, accountIdentity),
+			noncePaths(&b, accountPattern, accountIdentity),
+			configPaths(&b),
+			sendPaths(&b, accountPattern, accountIdentity),
+			verifyPaths(&b),
+			abiPaths(&b),
+			tokenPaths(&b),
+			erc20Paths(&b, accountPattern, accountIdentity),
+			requestPaths(&b),
+			rolePaths(&b),
+			credsPaths(&b),
+			walletPaths(&b),
+			addressPaths(&b),
 		),
 		PathsSpecial: &logical.Paths{
 			SealWrapStorage: []string{
 				"accounts/",
+				"wallets/",
+				"deleted-accounts/",
+				"deleted-wallets/",
+				"key-versions/",
 			},
 		},
-		Secrets:     []*framework.Secret{},
-		BackendType: logical.TypeLogical,
+		Secrets: []*framework.Secret{
+			ephemeralAccountSecret(&b),
+		},
+		BackendType:    logical.TypeLogical,
+		PeriodicFunc:   b.periodicFunc,
+		InitializeFunc: b.initialize,
 	}
+	b.newClient = dialClient
 	return &b
 }
 
+// initialize indexes the addresses of the accounts created before addresses
+// were indexed
+func (b *vaultEthereumBackend) initialize(ctx context.Context, req *logical.InitializationRequest) error {
+	return b.indexAccounts(ctx, req.Storage)
+}
+
+// periodicFunc purges the approval requests that expired and the deleted
+// accounts and wallets whose retention period ended
+func (b *vaultEthereumBackend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	if err := b.purgeExpiredRequests(ctx, req.Storage); err != nil {
+		return err
+	}
+	if err := b.purgeDeletedAccounts(ctx, req.Storage); err != nil {
+		return err
+	}
+	return b.purgeDeletedWallets(ctx, req.Storage)
+}
+
 // QualifiedPath prepends the token symbol to the path
 func QualifiedPath(subpath string) string {
 	return subpath
@@ -75,5 +127,9 @@ func QualifiedPath(subpath string) string {
 func SealWrappedPaths(b *vaultEthereumBackend) []string {
 	return []string{
 		QualifiedPath("accounts/"),
+		QualifiedPath("wallets/"),
+		QualifiedPath("deleted-accounts/"),
+		QualifiedPath("deleted-wallets/"),
+		QualifiedPath("key-versions/"),
 	}
 }
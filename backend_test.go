@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// testMnemonic derives testAddress at the default derivation path
+	testMnemonic = "test test test test test test test test test test test junk"
+	testAddress  = "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"
+	// testEntity is the entity making the requests of the tests
+	testEntity = "entity-requester"
+)
+
+// getTestBackend returns a backend over an in-memory storage
+func getTestBackend(t *testing.T) (*vaultEthereumBackend, logical.Storage) {
+	t.Helper()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b := backend()
+	if err := b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+// request handles a request made by testEntity
+func request(t *testing.T, b *vaultEthereumBackend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	t.Helper()
+	return requestAs(t, b, s, testEntity, op, path, data)
+}
+
+// requestAs handles a request made by entity. Writes are routed to the create
+// or update operation of the path like Vault does.
+func requestAs(t *testing.T, b *vaultEthereumBackend, s logical.Storage, entity string, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	t.Helper()
+	req := &logical.Request{
+		Operation:   op,
+		Path:        path,
+		Storage:     s,
+		Data:        data,
+		EntityID:    entity,
+		DisplayName: entity,
+	}
+	if op == logical.UpdateOperation {
+		checkFound, exists, err := b.HandleExistenceCheck(context.Background(), req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", op, path, err)
+		}
+		if checkFound && !exists {
+			req.Operation = logical.CreateOperation
+		}
+	}
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", op, path, err)
+	}
+	return resp
+}
+
+// mustSucceed fails the test when resp is an error
+func mustSucceed(t *testing.T, resp *logical.Response) *logical.Response {
+	t.Helper()
+	if resp == nil {
+		t.Fatal("expected a response")
+	}
+	if resp.IsError() {
+		t.Fatalf("unexpected error: %v", resp.Error())
+	}
+	return resp
+}
+
+// mustFail fails the test unless resp is an error
+func mustFail(t *testing.T, resp *logical.Response) *logical.Response {
+	t.Helper()
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error, got %v", resp)
+	}
+	return resp
+}
+
+// createTestAccount creates an account derived from testMnemonic
+func createTestAccount(t *testing.T, b *vaultEthereumBackend, s logical.Storage, name string) {
+	t.Helper()
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/"+name, map[string]interface{}{
+		"mnemonic": testMnemonic,
+	}))
+	if resp.Data["address"] != testAddress {
+		t.Fatalf("expected address %s, got %v", testAddress, resp.Data["address"])
+	}
+}
+
+// testRecipient is the address the transactions of the tests are sent to
+const testRecipient = "0x70997970C51812dc3A010C7d01b50e0d17dc79C8"
+
+// signTx signs a legacy transfer of value wei to testRecipient with the
+// account name, overridden by data. A nil value removes a field.
+func signTx(t *testing.T, b *vaultEthereumBackend, s logical.Storage, name string, value string, data map[string]interface{}) *logical.Response {
+	t.Helper()
+	return signTxAt(t, b, s, "accounts/"+name, value, data)
+}
+
+// signTxAt is signTx for the account at path, such as an account of a wallet
+func signTxAt(t *testing.T, b *vaultEthereumBackend, s logical.Storage, path string, value string, data map[string]interface{}) *logical.Response {
+	t.Helper()
+	request := map[string]interface{}{
+		"chain_id":  1,
+		"to":        testRecipient,
+		"value":     value,
+		"nonce":     0,
+		"gas_limit": "21000",
+		"gas_price": "1000000000",
+	}
+	for field, v := range data {
+		if v == nil {
+			delete(request, field)
+		} else {
+			request[field] = v
+		}
+	}
+	return requestAs(t, b, s, testEntity, logical.UpdateOperation, path+"/sign-tx", request)
+}
+
+// violatedRule returns the policy rule named by an error response
+func violatedRule(t *testing.T, resp *logical.Response) string {
+	t.Helper()
+	mustFail(t, resp)
+	details, ok := resp.Data["data"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected a policy violation, got %v", resp.Data)
+	}
+	return details["rule"].(string)
+}
+
+// signedTransaction decodes the transaction of a sign response
+func signedTransaction(t *testing.T, resp *logical.Response) *types.Transaction {
+	t.Helper()
+	mustSucceed(t, resp)
+	rawTx, err := hexutil.Decode(resp.Data["rlpSignature"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tx types.Transaction
+	if err := tx.UnmarshalBinary(rawTx); err != nil {
+		t.Fatal(err)
+	}
+	return &tx
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// RuleAllowedCalls restricts the contract methods a transaction may call
+	RuleAllowedCalls string = "allowed_calls"
+	// RuleDeniedCalls forbids contract methods
+	RuleDeniedCalls string = "denied_calls"
+	// RuleDenyUnknownSelectors rejects calls that no registered ABI declares
+	RuleDenyUnknownSelectors string = "deny_unknown_selectors"
+	// RuleMalformedCalldata rejects calls whose arguments do not decode
+	// against the registered ABI declaring their selector
+	RuleMalformedCalldata string = "malformed_calldata"
+
+	// Wildcard matches any contract or any method in a call rule
+	Wildcard string = "*"
+)
+
+var (
+	selectorRegex   = regexp.MustCompile(`^0x[0-9a-f]{8}$`)
+	methodNameRegex = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*(\(.*\))?$`)
+)
+
+// callRule matches contract calls by contract address and method. The method
+// is a name, a signature or a 0x prefixed 4-byte selector.
+type callRule struct {
+	Contract string
+	Method   string
+}
+
+// parseCallRule parses a rule written as <address|*>:<method|signature|selector|*>
+func parseCallRule(raw string) (callRule, error) {
+	parts := strings.SplitN(strings.TrimSpace(raw), ":", 2)
+	if len(parts) != 2 || parts[0] == Empty || parts[1] == Empty {
+		return callRule{}, fmt.Errorf("rule %s is not of the form <address>:<method>", raw)
+	}
+
+	rule := callRule{Contract: parts[0], Method: strings.ReplaceAll(parts[1], " ", Empty)}
+	if rule.Contract != Wildcard {
+		if !common.IsHexAddress(rule.Contract) {
+			return callRule{}, fmt.Errorf("invalid address %s in rule %s", rule.Contract, raw)
+		}
+		rule.Contract = common.HexToAddress(rule.Contract).Hex()
+	}
+	switch {
+	case rule.Method == Wildcard:
+	case strings.HasPrefix(rule.Method, "0x"):
+		rule.Method = strings.ToLower(rule.Method)
+		if !selectorRegex.MatchString(rule.Method) {
+			return callRule{}, fmt.Errorf("invalid selector %s in rule %s", rule.Method, raw)
+		}
+	case !methodNameRegex.MatchString(rule.Method):
+		return callRule{}, fmt.Errorf("invalid method %s in rule %s", rule.Method, raw)
+	}
+	return rule, nil
+}
+
+func (rule callRule) String() string {
+	return rule.Contract + ":" + rule.Method
+}
+
+// normalizeCallRules validates call rules and returns them in canonical form
+func normalizeCallRules(raw []string) ([]string, error) {
+	var rules []string
+	for _, item := range raw {
+		rule, err := parseCallRule(item)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule.String())
+	}
+	return rules, nil
+}
+
+// matches reports whether a call of selector on contract is matched by the
+// rule. Names and signatures are resolved to selectors through methods, the
+// registered methods with that selector, so that a rule applies whether or not
+// the arguments of the call decode.
+func (rule callRule) matches(contract common.Address, selector string, methods []abi.Method) bool {
+	if rule.Contract != Wildcard && rule.Contract != contract.Hex() {
+		return false
+	}
+	if rule.Method == Wildcard || rule.Method == selector {
+		return true
+	}
+	if strings.Contains(rule.Method, "(") && hexutil.Encode(crypto.Keccak256([]byte(rule.Method))[:4]) == selector {
+		return true
+	}
+	for _, method := range methods {
+		if rule.Method == method.RawName || rule.Method == method.Sig {
+			return true
+		}
+	}
+	return false
+}
+
+// selectorIndex maps 4-byte selectors to the methods of the registered ABIs
+type selectorIndex map[string][]abi.Method
+
+// loadSelectorIndex indexes the methods of every registered ABI by selector
+func loadSelectorIndex(ctx context.Context, s logical.Storage) (selectorIndex, error) {
+	names, err := s.List(ctx, QualifiedPath("abis/"))
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(selectorIndex)
+	for _, name := range names {
+		contractABI, err := readContractABI(ctx, s, name)
+		if err != nil {
+			return nil, err
+		}
+		if contractABI == nil {
+			continue
+		}
+		parsed, err := contractABI.parse()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ABI %s: %v", name, err)
+		}
+		for _, method := range parsed.Methods {
+			selector := hexutil.Encode(method.ID)
+			index[selector] = append(index[selector], method)
+		}
+	}
+	return index, nil
+}
+
+// decode returns the selector of calldata, the registered methods with that
+// selector and the first of them the arguments decode against, if any
+func (index selectorIndex) decode(input []byte) (string, []abi.Method, *abi.Method) {
+	selector := hexutil.Encode(input[:4])
+	methods := index[selector]
+	for i, method := range methods {
+		if _, err := method.Inputs.Unpack(input[4:]); err == nil {
+			return selector, methods, &methods[i]
+		}
+	}
+	return selector, methods, nil
+}
+
+// hasCallRules reports whether the policy restricts contract calls
+func (policy *AccountPolicy) hasCallRules() bool {
+	return policy != nil && (len(policy.AllowedCalls) > 0 || len(policy.DeniedCalls) > 0 || policy.DenyUnknownSelectors)
+}
+
+// matchesTransfer reports whether the rule matches a transaction without
+// calldata to contract. Only method wildcards match such transfers.
+func (rule callRule) matchesTransfer(contract common.Address) bool {
+	return rule.Method == Wildcard && (rule.Contract == Wildcard || rule.Contract == contract.Hex())
+}
+
+// EvaluateCall checks the calldata of a transaction against the call rules of
+// the policy. A transaction without calldata is matched only by rules whose
+// method is *, so allowed_calls must list <address>:* for plain transfers.
+// Deployments have no contract to match and are rejected once allowed_calls
+// is set.
+func (policy *AccountPolicy) EvaluateCall(tx *types.Transaction, index selectorIndex) *PolicyViolation {
+	if !policy.hasCallRules() {
+		return nil
+	}
+	if tx.To() == nil {
+		if len(policy.AllowedCalls) > 0 {
+			return &PolicyViolation{RuleAllowedCalls, "contract deployments are not allowed"}
+		}
+		return nil
+	}
+	contract := *tx.To()
+
+	if len(tx.Data()) == 0 {
+		return policy.evaluateTransfer(contract)
+	}
+	if len(tx.Data()) < 4 {
+		return &PolicyViolation{RuleAllowedCalls, fmt.Sprintf("calldata to %s is shorter than a selector", contract.Hex())}
+	}
+	selector, methods, decoded := index.decode(tx.Data())
+
+	call := selector
+	if len(methods) > 0 {
+		call = methods[0].Sig
+	}
+
+	if policy.DenyUnknownSelectors && len(methods) == 0 {
+		return &PolicyViolation{RuleDenyUnknownSelectors, fmt.Sprintf("selector %s on %s is not declared by any registered ABI", selector, contract.Hex())}
+	}
+
+	for _, raw := range policy.DeniedCalls {
+		rule, err := parseCallRule(raw)
+		if err != nil {
+			return &PolicyViolation{RuleDeniedCalls, err.Error()}
+		}
+		if rule.matches(contract, selector, methods) {
+			return &PolicyViolation{RuleDeniedCalls, fmt.Sprintf("call to %s on %s is denied by %s", call, contract.Hex(), rule)}
+		}
+	}
+
+	if len(methods) > 0 && decoded == nil {
+		return &PolicyViolation{RuleMalformedCalldata, fmt.Sprintf("arguments of %s on %s do not decode", call, contract.Hex())}
+	}
+
+	if len(policy.AllowedCalls) > 0 {
+		for _, raw := range policy.AllowedCalls {
+			rule, err := parseCallRule(raw)
+			if err != nil {
+				return &PolicyViolation{RuleAllowedCalls, err.Error()}
+			}
+			if rule.matches(contract, selector, methods) {
+				return nil
+			}
+		}
+		return &PolicyViolation{RuleAllowedCalls, fmt.Sprintf("call to %s on %s is not allowed", call, contract.Hex())}
+	}
+
+	return nil
+}
+
+// evaluateTransfer checks a transaction without calldata to contract against
+// the call rules
+func (policy *AccountPolicy) evaluateTransfer(contract common.Address) *PolicyViolation {
+	for _, raw := range policy.DeniedCalls {
+		rule, err := parseCallRule(raw)
+		if err != nil {
+			return &PolicyViolation{RuleDeniedCalls, err.Error()}
+		}
+		if rule.matchesTransfer(contract) {
+			return &PolicyViolation{RuleDeniedCalls, fmt.Sprintf("transfer to %s is denied by %s", contract.Hex(), rule)}
+		}
+	}
+
+	if len(policy.AllowedCalls) > 0 {
+		for _, raw := range policy.AllowedCalls {
+			rule, err := parseCallRule(raw)
+			if err != nil {
+				return &PolicyViolation{RuleAllowedCalls, err.Error()}
+			}
+			if rule.matchesTransfer(contract) {
+				return nil
+			}
+		}
+		return &PolicyViolation{RuleAllowedCalls, fmt.Sprintf("transfer to %s is not allowed", contract.Hex())}
+	}
+
+	return nil
+}
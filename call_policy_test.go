@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	testOperatorABI = `[{"type": "function", "name": "setApprovalForAll", "inputs": [{"name": "operator", "type": "address"}, {"name": "approved", "type": "bool"}]}]`
+	testToken       = "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"
+	testOther       = "0x0000000000000000000000000000000000000009"
+)
+
+// setApprovalForAllCalldata encodes setApprovalForAll(operator, approved)
+// with approved as a raw word, so that values other than 0 and 1 can be sent
+func setApprovalForAllCalldata(operator string, approved int64) string {
+	input := crypto.Keccak256([]byte("setApprovalForAll(address,bool)"))[:4]
+	input = append(input, common.LeftPadBytes(common.HexToAddress(operator).Bytes(), 32)...)
+	input = append(input, math.U256Bytes(big.NewInt(approved))...)
+	return hex.EncodeToString(input)
+}
+
+// setupCallPolicy creates the account test, registers the test ABIs and
+// writes the call rules of its policy
+func setupCallPolicy(t *testing.T, policy map[string]interface{}) (*vaultEthereumBackend, logical.Storage) {
+	t.Helper()
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	registerTestABI(t, b, s)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "abis/operator", map[string]interface{}{
+		"abi": testOperatorABI,
+	}))
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", policy))
+	return b, s
+}
+
+// signCall signs a call to contract with the account test
+func signCall(t *testing.T, b *vaultEthereumBackend, s logical.Storage, contract string, data map[string]interface{}) *logical.Response {
+	t.Helper()
+	data["to"] = contract
+	data["gas_limit"] = "100000"
+	return signTx(t, b, s, "test", "0", data)
+}
+
+func expectRule(t *testing.T, resp *logical.Response, expected string) {
+	t.Helper()
+	if rule := violatedRule(t, resp); rule != expected {
+		t.Fatalf("expected rule %s, got %s", expected, rule)
+	}
+}
+
+func TestCallRules(t *testing.T) {
+	b, s := setupCallPolicy(t, map[string]interface{}{
+		"allowed_calls": []interface{}{testToken + ":transfer", testToken + ":approve(address, uint256)"},
+		"denied_calls":  []interface{}{"*:setApprovalForAll"},
+	})
+
+	call := func(abi, method string, args string) map[string]interface{} {
+		return map[string]interface{}{"contract_abi": abi, "method": method, "args": args}
+	}
+	mustSucceed(t, signCall(t, b, s, testToken, call("token", "transfer", `["`+testOther+`", "1"]`)))
+	mustSucceed(t, signCall(t, b, s, testToken, call("token", "approve", `["`+testOther+`", "1"]`)))
+
+	for _, c := range []struct {
+		name     string
+		contract string
+		data     map[string]interface{}
+		rule     string
+	}{
+		{"other contract", testOther, call("token", "transfer", `["`+testOther+`", "1"]`), RuleAllowedCalls},
+		{"denied method", testToken, call("operator", "setApprovalForAll", `["`+testOther+`", true]`), RuleDeniedCalls},
+		{"undeclared selector", testToken, map[string]interface{}{"data": "deadbeef"}, RuleAllowedCalls},
+		{"short calldata", testToken, map[string]interface{}{"data": "dead"}, RuleAllowedCalls},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			expectRule(t, signCall(t, b, s, c.contract, c.data), c.rule)
+		})
+	}
+
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/test/policy", nil))
+	if allowed := resp.Data["allowed_calls"].([]string); allowed[1] != testToken+":approve(address,uint256)" {
+		t.Fatalf("expected rules in canonical form, got %v", allowed)
+	}
+}
+
+func TestCallRulesSelectors(t *testing.T) {
+	b, s := setupCallPolicy(t, map[string]interface{}{
+		"allowed_calls": []interface{}{"*:0xDEADBEEF"},
+	})
+
+	mustSucceed(t, signCall(t, b, s, testOther, map[string]interface{}{"data": "deadbeef00"}))
+	expectRule(t, signCall(t, b, s, testOther, map[string]interface{}{"data": "cafebabe"}), RuleAllowedCalls)
+}
+
+func TestCallRulesDenyUnknownSelectors(t *testing.T) {
+	b, s := setupCallPolicy(t, map[string]interface{}{"deny_unknown_selectors": true})
+
+	mustSucceed(t, signCall(t, b, s, testToken, map[string]interface{}{
+		"contract_abi": "token",
+		"method":       "transfer",
+		"args":         `["` + testOther + `", "1"]`,
+	}))
+	mustSucceed(t, signCall(t, b, s, testToken, map[string]interface{}{}))
+	expectRule(t, signCall(t, b, s, testToken, map[string]interface{}{"data": "deadbeef"}), RuleDenyUnknownSelectors)
+}
+
+// Calldata that does not decode against the ABI declaring its selector used
+// to escape the rules naming its method
+func TestCallRulesMalformedCalldata(t *testing.T) {
+	b, s := setupCallPolicy(t, map[string]interface{}{
+		"denied_calls": []interface{}{"*:setApprovalForAll"},
+	})
+	malformed := func() map[string]interface{} {
+		return map[string]interface{}{"data": setApprovalForAllCalldata(testOther, 2)}
+	}
+	expectRule(t, signCall(t, b, s, testToken, malformed()), RuleDeniedCalls)
+
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", map[string]interface{}{
+		"allowed_calls": []interface{}{testToken + ":*"},
+		"denied_calls":  []interface{}{},
+	}))
+	mustSucceed(t, signCall(t, b, s, testToken, map[string]interface{}{"data": setApprovalForAllCalldata(testOther, 1)}))
+	expectRule(t, signCall(t, b, s, testToken, malformed()), RuleMalformedCalldata)
+}
+
+func TestCallRulesSignatureWithoutABI(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", map[string]interface{}{
+		"denied_calls": []interface{}{"*:setApprovalForAll(address,bool)"},
+	}))
+
+	expectRule(t, signCall(t, b, s, testToken, map[string]interface{}{"data": setApprovalForAllCalldata(testOther, 1)}), RuleDeniedCalls)
+	mustSucceed(t, signCall(t, b, s, testToken, map[string]interface{}{"data": "deadbeef"}))
+}
+
+// Transactions without calldata are only matched by method wildcards
+func TestCallRulesTransfers(t *testing.T) {
+	b, s := setupCallPolicy(t, map[string]interface{}{
+		"allowed_calls": []interface{}{testToken + ":transfer", testRecipient + ":*"},
+	})
+	mustSucceed(t, signCall(t, b, s, testRecipient, map[string]interface{}{}))
+	expectRule(t, signCall(t, b, s, testToken, map[string]interface{}{}), RuleAllowedCalls)
+
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", map[string]interface{}{
+		"allowed_calls": []interface{}{},
+		"denied_calls":  []interface{}{testRecipient + ":*", "*:transfer"},
+	}))
+	expectRule(t, signCall(t, b, s, testRecipient, map[string]interface{}{}), RuleDeniedCalls)
+	mustSucceed(t, signCall(t, b, s, testToken, map[string]interface{}{}))
+
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", map[string]interface{}{
+		"denied_calls": []interface{}{"*:*"},
+	}))
+	expectRule(t, signCall(t, b, s, testToken, map[string]interface{}{}), RuleDeniedCalls)
+}
+
+func TestCallRulesDeployments(t *testing.T) {
+	deploy := map[string]interface{}{"to": nil, "bytecode": testInitCode, "gas_limit": "100000"}
+
+	b, s := setupCallPolicy(t, map[string]interface{}{
+		"denied_calls": []interface{}{"*:setApprovalForAll"},
+	})
+	mustSucceed(t, signTx(t, b, s, "test", "0", deploy))
+
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", map[string]interface{}{
+		"allowed_calls": []interface{}{"*:*"},
+	}))
+	expectRule(t, signTx(t, b, s, "test", "0", deploy), RuleAllowedCalls)
+}
+
+func TestCallRulesRejectInvalidRules(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	for _, rule := range []string{"transfer", "0x1234:transfer", "*:0x1234", "*:not-a-method"} {
+		mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", map[string]interface{}{
+			"allowed_calls": []interface{}{rule},
+		}))
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// RuleMaxTokenAmount caps the amount of a token moved or approved by a single transaction
+const RuleMaxTokenAmount string = "max_token_amounts"
+
+// erc20JSON declares the ERC-20 methods that move or approve tokens
+const erc20JSON = `[
+	{"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"type":"bool"}]},
+	{"type":"function","name":"transferFrom","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"type":"bool"}]},
+	{"type":"function","name":"approve","inputs":[{"name":"spender","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"type":"bool"}]}
+]`
+
+var erc20ABI = mustParseABI(erc20JSON)
+
+func mustParseABI(raw string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(raw))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// erc20Amount decodes the token amount of an ERC-20 transfer, transferFrom or
+// approve call. The amount is nil for any other calldata.
+func erc20Amount(input []byte) (*abi.Method, *big.Int) {
+	if len(input) < 4 {
+		return nil, nil
+	}
+	for _, method := range erc20ABI.Methods {
+		if !bytes.Equal(input[:4], method.ID) {
+			continue
+		}
+		values, err := method.Inputs.Unpack(input[4:])
+		if err != nil {
+			return nil, nil
+		}
+		method := method
+		return &method, values[len(values)-1].(*big.Int)
+	}
+	return nil, nil
+}
+
+// evaluateTokenAmount checks the ERC-20 amount of a transaction against the
+// cap of its token contract
+func (policy *AccountPolicy) evaluateTokenAmount(tx *types.Transaction) *PolicyViolation {
+	if len(policy.MaxTokenAmounts) == 0 || tx.To() == nil {
+		return nil
+	}
+	rawMax, ok := policy.MaxTokenAmounts[tx.To().Hex()]
+	if !ok {
+		return nil
+	}
+	method, amount := erc20Amount(tx.Data())
+	if amount == nil {
+		return nil
+	}
+	maxAmount, _ := new(big.Int).SetString(rawMax, 10)
+	if amount.Cmp(maxAmount) > 0 {
+		return &PolicyViolation{RuleMaxTokenAmount, fmt.Sprintf("%s of %s on %s exceeds %s", method.RawName, amount, tx.To().Hex(), maxAmount)}
+	}
+	return nil
+}
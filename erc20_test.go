@@ -0,0 +1,170 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/bliiitz/vault-ethereum/util"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// registerTestToken registers testToken as usdc with 6 decimals
+func registerTestToken(t *testing.T, b *vaultEthereumBackend, s logical.Storage) {
+	t.Helper()
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "config/tokens/usdc", map[string]interface{}{
+		"address":  testToken,
+		"decimals": 6,
+		"symbol":   "USDC",
+	}))
+}
+
+// signTransfer signs a transfer of amount usdc to testRecipient with the
+// account test, overridden by data. A nil value removes a field.
+func signTransfer(t *testing.T, b *vaultEthereumBackend, s logical.Storage, amount string, data map[string]interface{}) *logical.Response {
+	t.Helper()
+	request := map[string]interface{}{
+		"chain_id":                 1,
+		"token":                    "usdc",
+		"to":                       testRecipient,
+		"amount":                   amount,
+		"nonce":                    0,
+		"gas_limit":                "65000",
+		"max_fee_per_gas":          "40000000000",
+		"max_priority_fee_per_gas": "1000000000",
+	}
+	for field, v := range data {
+		if v == nil {
+			delete(request, field)
+		} else {
+			request[field] = v
+		}
+	}
+	return requestAs(t, b, s, testEntity, logical.UpdateOperation, "accounts/test/sign-erc20-transfer", request)
+}
+
+func TestTokenAmount(t *testing.T) {
+	if amount := util.TokenAmount(250, 18); amount.String() != "250000000000000000000" {
+		t.Fatalf("unexpected amount %s", amount)
+	}
+
+	for amount, expected := range map[string]string{
+		"250.75": "250750000",
+		"1":      "1000000",
+		".5":     "500000",
+		"0.0001": "100",
+	} {
+		parsed, err := util.ParseTokenAmount(amount, 6)
+		if err != nil || parsed.String() != expected {
+			t.Fatalf("%s: expected %s, got %v, %v", amount, expected, parsed, err)
+		}
+	}
+	for _, amount := range []string{"", ".", "-1", "1e6", "0.0000001", "1.2.3"} {
+		if _, err := util.ParseTokenAmount(amount, 6); err == nil {
+			t.Fatalf("expected %q to be rejected", amount)
+		}
+	}
+}
+
+func TestTokenRegistry(t *testing.T) {
+	b, s := getTestBackend(t)
+	registerTestToken(t, b, s)
+
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "config/tokens/usdc", nil))
+	if resp.Data["address"] != testToken || resp.Data["decimals"] != uint8(6) || resp.Data["symbol"] != "USDC" {
+		t.Fatalf("unexpected token %v", resp.Data)
+	}
+
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "config/tokens/bad", map[string]interface{}{"address": "nope"}))
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "config/tokens/bad", map[string]interface{}{"address": testOther, "decimals": 256}))
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "config/tokens/bad", map[string]interface{}{"symbol": "BAD"}))
+
+	request(t, b, s, logical.DeleteOperation, "config/tokens/usdc", nil)
+	if resp := request(t, b, s, logical.ReadOperation, "config/tokens/usdc", nil); resp != nil {
+		t.Fatalf("expected the token to be deleted, got %v", resp.Data)
+	}
+}
+
+func TestSignERC20Transfer(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	registerTestToken(t, b, s)
+
+	resp := signTransfer(t, b, s, "250.75", nil)
+	tx := signedTransaction(t, resp)
+	if tx.Type() != types.DynamicFeeTxType || tx.To().Hex() != testToken || tx.Value().Sign() != 0 {
+		t.Fatalf("unexpected transaction to %s of type %d", tx.To().Hex(), tx.Type())
+	}
+	method, amount := erc20Amount(tx.Data())
+	if method == nil || method.RawName != "transfer" || amount.Cmp(big.NewInt(250750000)) != 0 {
+		t.Fatalf("unexpected calldata %x", tx.Data())
+	}
+	if transfer := resp.Data["transfer"].(map[string]interface{}); transfer["raw_amount"] != "250750000" || transfer["symbol"] != "USDC" {
+		t.Fatalf("unexpected transfer %v", transfer)
+	}
+
+	// the token may also be named by its address
+	resp = signTransfer(t, b, s, "1", map[string]interface{}{"token": testToken, "tx_type": "legacy", "gas_price": "1000000000"})
+	if tx := signedTransaction(t, resp); tx.Type() != types.LegacyTxType {
+		t.Fatalf("expected a legacy transaction, got type %d", tx.Type())
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"token": "dai"},
+		{"to": "nope"},
+		{"amount": "0.0000001"},
+		{"tx_type": "2930"},
+	} {
+		mustFail(t, signTransfer(t, b, s, "1", data))
+	}
+}
+
+// Without tx_type, a transfer has the type of its chain
+func TestSignERC20TransferChainTxType(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	registerTestToken(t, b, s)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "config/chains/bsc", map[string]interface{}{
+		"chain_id": 56,
+		"tx_type":  TxTypeLegacy,
+	}))
+
+	resp := signTransfer(t, b, s, "1", map[string]interface{}{"chain_id": nil, "chain": "bsc", "gas_price": "1000000000"})
+	if tx := signedTransaction(t, resp); tx.Type() != types.LegacyTxType {
+		t.Fatalf("expected a legacy transaction, got type %d", tx.Type())
+	}
+}
+
+func TestMaxTokenAmounts(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	registerTestToken(t, b, s)
+
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", map[string]interface{}{
+		"max_token_amounts": "usdc=1000.5",
+	}))
+	if caps := resp.Data["max_token_amounts"].(map[string]string); caps[testToken] != "1000500000" {
+		t.Fatalf("expected the cap in base units, got %v", caps)
+	}
+
+	// the cap applies to each transaction on its own
+	mustSucceed(t, signTransfer(t, b, s, "1000.5", nil))
+	mustSucceed(t, signTransfer(t, b, s, "1000.5", map[string]interface{}{"nonce": 1}))
+	if rule := violatedRule(t, signTransfer(t, b, s, "1000.51", nil)); rule != RuleMaxTokenAmount {
+		t.Fatalf("expected rule %s, got %s", RuleMaxTokenAmount, rule)
+	}
+
+	// approvals signed as raw calldata are capped too
+	input, err := erc20ABI.Pack("approve", common.HexToAddress(testOther), big.NewInt(2000000000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = signTx(t, b, s, "test", "0", map[string]interface{}{"to": testToken, "data": common.Bytes2Hex(input), "gas_limit": "65000"})
+	if rule := violatedRule(t, resp); rule != RuleMaxTokenAmount {
+		t.Fatalf("expected rule %s, got %s", RuleMaxTokenAmount, rule)
+	}
+
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", map[string]interface{}{"max_token_amounts": "dai=1"}))
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", map[string]interface{}{"max_token_amounts": "usdc=-1"}))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// metadataFields are the fields describing an account to its operators
+var metadataFields = map[string]*framework.FieldSchema{
+	"description": {
+		Type:        framework.TypeString,
+		Description: "A free-form description of the account.",
+	},
+	"owner": {
+		Type:        framework.TypeString,
+		Description: "The team or person owning the account.",
+	},
+	"tags": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "Free-form tags used to filter the account list.",
+	},
+}
+
+// lastUsedPath is where the time an account last signed is kept. It is
+// stored apart from the account so that signing does not rewrite the key.
+func lastUsedPath(name string) string {
+	return QualifiedPath(fmt.Sprintf("last-used/%s", name))
+}
+
+// applyMetadata sets the metadata fields present in data on the account
+func applyMetadata(accountJSON *AccountJSON, data *framework.FieldData) {
+	if description, ok := data.GetOk("description"); ok {
+		accountJSON.Description = description.(string)
+	}
+	if owner, ok := data.GetOk("owner"); ok {
+		accountJSON.Owner = owner.(string)
+	}
+	if tags, ok := data.GetOk("tags"); ok {
+		accountJSON.Tags = nil
+		for _, tag := range tags.([]string) {
+			if tag = strings.TrimSpace(tag); tag != Empty {
+				accountJSON.Tags = append(accountJSON.Tags, tag)
+			}
+		}
+	}
+}
+
+// hasTags reports whether the account carries every one of tags
+func (accountJSON AccountJSON) hasTags(tags []string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, accountTag := range accountJSON.Tags {
+			if accountTag == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// metadata renders the metadata of an account, along with the time it last
+// signed
+func (accountJSON AccountJSON) metadata(lastUsed time.Time) map[string]interface{} {
+	metadata := map[string]interface{}{
+		"description":  accountJSON.Description,
+		"owner":        accountJSON.Owner,
+		"tags":         accountJSON.Tags,
+		"created_at":   nil,
+		"last_used_at": nil,
+	}
+	if !accountJSON.CreatedAt.IsZero() {
+		metadata["created_at"] = accountJSON.CreatedAt.Format(time.RFC3339)
+	}
+	if !lastUsed.IsZero() {
+		metadata["last_used_at"] = lastUsed.Format(time.RFC3339)
+	}
+	return metadata
+}
+
+func readLastUsed(ctx context.Context, s logical.Storage, name string) (time.Time, error) {
+	entry, err := s.Get(ctx, lastUsedPath(name))
+	if err != nil || entry == nil {
+		return time.Time{}, err
+	}
+	var lastUsed time.Time
+	if err := entry.DecodeJSON(&lastUsed); err != nil {
+		return time.Time{}, fmt.Errorf("failed to deserialize the last use of account %s: %v", name, err)
+	}
+	return lastUsed, nil
+}
+
+// touchAccount records that the account called name signed something. The
+// accounts of wallets are not stored and are not tracked.
+func touchAccount(ctx context.Context, s logical.Storage, name string) error {
+	if _, _, ok := parseWalletAccountName(name); ok {
+		return nil
+	}
+	entry, err := logical.StorageEntryJSON(lastUsedPath(name), time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestAccountMetadata(t *testing.T) {
+	b, s := getTestBackend(t)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/treasury", map[string]interface{}{
+		"mnemonic":    testMnemonic,
+		"description": "Treasury hot wallet",
+		"owner":       "finance",
+		"tags":        "hot, treasury,",
+	}))
+
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/treasury", nil))
+	if resp.Data["description"] != "Treasury hot wallet" || resp.Data["owner"] != "finance" || resp.Data["created_at"] == nil || resp.Data["last_used_at"] != nil {
+		t.Fatalf("unexpected metadata %v", resp.Data)
+	}
+	if tags := resp.Data["tags"].([]string); len(tags) != 2 || tags[0] != "hot" || tags[1] != "treasury" {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/treasury/sign", map[string]interface{}{
+		"message": "hello",
+	}))
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/treasury", nil))
+	if resp.Data["last_used_at"] == nil {
+		t.Fatalf("expected the signature to be recorded, got %v", resp.Data)
+	}
+
+	request(t, b, s, logical.DeleteOperation, "accounts/treasury", nil)
+	request(t, b, s, logical.DeleteOperation, "deleted-accounts/treasury", nil)
+	if entry, err := s.Get(context.Background(), lastUsedPath("treasury")); err != nil || entry != nil {
+		t.Fatalf("expected the last use to be purged with the account, got %v, %v", entry, err)
+	}
+}
+
+func TestAccountListFiltersByTag(t *testing.T) {
+	b, s := getTestBackend(t)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/treasury", map[string]interface{}{
+		"mnemonic": testMnemonic,
+		"tags":     "hot,treasury",
+	}))
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/cold", map[string]interface{}{
+		"private_key": hexutil.Encode(cowKey),
+		"tags":        "cold",
+	}))
+	mustSucceed(t, signTx(t, b, s, "treasury", "1", nil))
+
+	resp := mustSucceed(t, request(t, b, s, logical.ListOperation, "accounts/", nil))
+	if keys := resp.Data["keys"].([]string); len(keys) != 2 {
+		t.Fatalf("expected both accounts, got %v", keys)
+	}
+	info := resp.Data["key_info"].(map[string]interface{})["treasury"].(map[string]interface{})
+	if info["address"] != testAddress || info["last_used_at"] == nil {
+		t.Fatalf("unexpected key info %v", info)
+	}
+
+	for tags, expected := range map[string]string{"treasury": "treasury", "hot,treasury": "treasury", "cold": "cold"} {
+		resp := mustSucceed(t, request(t, b, s, logical.ListOperation, "accounts/", map[string]interface{}{"tag": tags}))
+		if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != expected {
+			t.Fatalf("expected %s to list %s, got %v", tags, expected, keys)
+		}
+	}
+	resp = request(t, b, s, logical.ListOperation, "accounts/", map[string]interface{}{"tag": "hot,cold"})
+	if keys, _ := resp.Data["keys"].([]string); len(keys) != 0 {
+		t.Fatalf("expected no account, got %v", keys)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// NonceCounter tracks the nonces handed out for an account on a chain. Nonces
+// of transactions that never made it on chain can be marked as dropped; they
+// are handed out again before the counter advances.
+type NonceCounter struct {
+	Next    uint64   `json:"next"`
+	Dropped []uint64 `json:"dropped"`
+}
+
+// nonceRoot is where the nonce counters of an account are stored. The counters
+// of the accounts of a wallet are kept apart, so that they are never listed
+// with those of an account named like the wallet.
+func nonceRoot(name string) string {
+	if wallet, index, ok := parseWalletAccountName(name); ok {
+		return QualifiedPath(fmt.Sprintf("wallet-nonces/%s/%d/", wallet, index))
+	}
+	return QualifiedPath(fmt.Sprintf("nonces/%s/", name))
+}
+
+func noncePath(name string, chainID int64) string {
+	return fmt.Sprintf("%s%d", nonceRoot(name), chainID)
+}
+
+// readNonceCounter returns the nonce counter of the account on chainID, or
+// nil when nonces are not managed on that chain
+func readNonceCounter(ctx context.Context, s logical.Storage, name string, chainID int64) (*NonceCounter, error) {
+	entry, err := s.Get(ctx, noncePath(name, chainID))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var counter NonceCounter
+	if err := entry.DecodeJSON(&counter); err != nil {
+		return nil, fmt.Errorf("failed to deserialize nonce counter of %s on chain %d: %v", name, chainID, err)
+	}
+	return &counter, nil
+}
+
+func writeNonceCounter(ctx context.Context, s logical.Storage, name string, chainID int64, counter *NonceCounter) error {
+	entry, err := logical.StorageEntryJSON(noncePath(name, chainID), counter)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// allocate hands out the lowest dropped nonce, or the next one
+func (counter *NonceCounter) allocate() uint64 {
+	if len(counter.Dropped) > 0 {
+		nonce := counter.Dropped[0]
+		counter.Dropped = counter.Dropped[1:]
+		return nonce
+	}
+	nonce := counter.Next
+	counter.Next++
+	return nonce
+}
+
+// observe keeps the counter in sync with a nonce chosen by the caller
+func (counter *NonceCounter) observe(nonce uint64) {
+	if nonce >= counter.Next {
+		counter.Next = nonce + 1
+	}
+	dropped := counter.Dropped[:0]
+	for _, candidate := range counter.Dropped {
+		if candidate != nonce {
+			dropped = append(dropped, candidate)
+		}
+	}
+	counter.Dropped = dropped
+}
+
+// drop marks a previously allocated nonce as free to be allocated again
+func (counter *NonceCounter) drop(nonce uint64) error {
+	if nonce >= counter.Next {
+		return fmt.Errorf("nonce %d has not been allocated yet", nonce)
+	}
+	for _, candidate := range counter.Dropped {
+		if candidate == nonce {
+			return nil
+		}
+	}
+	counter.Dropped = append(counter.Dropped, nonce)
+	sort.Slice(counter.Dropped, func(i, j int) bool { return counter.Dropped[i] < counter.Dropped[j] })
+	return nil
+}
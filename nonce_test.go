@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// signedNonce signs a transfer with the account name without a nonce and
+// returns the nonce it was given
+func signedNonce(t *testing.T, b *vaultEthereumBackend, s logical.Storage, name string) uint64 {
+	t.Helper()
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/"+name+"/sign-tx", map[string]interface{}{
+		"chain_id":  1,
+		"to":        testRecipient,
+		"gas_limit": "21000",
+		"gas_price": "1000000000",
+	}))
+	return resp.Data["signedTransaction"].(*types.Transaction).Nonce()
+}
+
+func TestManagedNonces(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	resp := request(t, b, s, logical.UpdateOperation, "accounts/test/sign-tx", map[string]interface{}{
+		"chain_id":  1,
+		"to":        testRecipient,
+		"gas_limit": "21000",
+		"gas_price": "1000000000",
+	})
+	mustFail(t, resp)
+
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/nonces/1", map[string]interface{}{
+		"next": 5,
+	}))
+	for _, want := range []uint64{5, 6} {
+		if nonce := signedNonce(t, b, s, "test"); nonce != want {
+			t.Fatalf("expected nonce %d, got %d", want, nonce)
+		}
+	}
+
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/nonces/1/drop", map[string]interface{}{
+		"nonce": 5,
+	}))
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test/nonces/1/drop", map[string]interface{}{
+		"nonce": 7,
+	}))
+	if nonce := signedNonce(t, b, s, "test"); nonce != 5 {
+		t.Fatalf("expected the dropped nonce 5 to be reused, got %d", nonce)
+	}
+
+	mustSucceed(t, signTx(t, b, s, "test", "1", map[string]interface{}{"nonce": 10}))
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/test/nonces/1", nil))
+	if resp.Data["next"] != uint64(11) || !reflect.DeepEqual(resp.Data["dropped"], []uint64{}) {
+		t.Fatalf("expected the counter to observe nonce 10, got %v", resp.Data)
+	}
+
+	resp = mustSucceed(t, request(t, b, s, logical.ListOperation, "accounts/test/nonces/", nil))
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"1"}) {
+		t.Fatalf("expected the counter of chain 1 to be listed, got %v", resp.Data["keys"])
+	}
+
+	request(t, b, s, logical.DeleteOperation, "accounts/test/nonces/1", nil)
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test/sign-tx", map[string]interface{}{
+		"chain_id":  1,
+		"to":        testRecipient,
+		"gas_limit": "21000",
+		"gas_price": "1000000000",
+	}))
+}
+
+func TestNonceResetDefaultsToZero(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/nonces/1", nil))
+	if resp.Data["next"] != uint64(0) {
+		t.Fatalf("expected the counter to start at 0, got %v", resp.Data["next"])
+	}
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/missing/nonces/1", nil))
+}
+
+func TestAccountPurgeRemovesNonceCounters(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/nonces/1", map[string]interface{}{
+		"next": 3,
+	}))
+
+	request(t, b, s, logical.DeleteOperation, "accounts/test", nil)
+	request(t, b, s, logical.DeleteOperation, "deleted-accounts/test", nil)
+	createTestAccount(t, b, s, "test")
+	if resp := request(t, b, s, logical.ReadOperation, "accounts/test/nonces/1", nil); resp != nil {
+		t.Fatalf("expected the counter to be purged with the account, got %v", resp.Data)
+	}
+}
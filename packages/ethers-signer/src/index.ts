@@ -196,6 +196,7 @@ export class VaultEthereumSigner extends Signer implements TypedDataSigner {
             },
             body: JSON.stringify({
                 message,
+                legacy_v: true,
             })
         })
         let signTxResponse: {data: {signature: string}} = await signTxRequest.json()
@@ -203,19 +204,29 @@ export class VaultEthereumSigner extends Signer implements TypedDataSigner {
     }
 
     async _signTypedData(domain: TypedDataDomain, types: Record<string, Array<TypedDataField>>, value: Record<string, any>): Promise<string> {
-        throw Error("_signTypedData not implemented")
         // Populate any ENS names
-        // const populated = await _TypedDataEncoder.resolveNames(domain, types, value, (name: string) => {
-        //     if (this.provider == null) {
-        //         logger.throwError("cannot resolve ENS names without a provider", Logger.errors.UNSUPPORTED_OPERATION, {
-        //             operation: "resolveName",
-        //             value: name
-        //         });
-        //     }
-        //     return this.provider.resolveName(name);
-        // });
-
-        // return joinSignature(this._signingKey().signDigest(_TypedDataEncoder.hash(populated.domain, types, populated.value)));
+        const populated = await _TypedDataEncoder.resolveNames(domain, types, value, (name: string) => {
+            if (this.provider == null) {
+                logger.throwError("cannot resolve ENS names without a provider", Logger.errors.UNSUPPORTED_OPERATION, {
+                    operation: "resolveName",
+                    value: name
+                });
+            }
+            return this.provider.resolveName(name);
+        });
+
+        let signTypedDataRequest = await fetch(`${this.config.endpoint}/v1/${this.config.pluginPath}/accounts/${this.account}/sign-typed-data`, {
+            method: "POST",
+            headers: {
+                Authorization: `Bearer ${this.vaultToken}`
+            },
+            body: JSON.stringify({
+                typed_data: JSON.stringify(_TypedDataEncoder.getPayload(populated.domain, types, populated.value)),
+                legacy_v: true,
+            })
+        })
+        let signTypedDataResponse: {data: {signature: string}} = await signTypedDataRequest.json()
+        return signTypedDataResponse.data.signature;
     }
 }
     
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// ContractABI is a contract interface registered for encoding calls
+type ContractABI struct {
+	ABI         string `json:"abi"`
+	Description string `json:"description,omitempty"`
+}
+
+func abiPaths(b *vaultEthereumBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("abis/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathABIsList,
+			},
+			HelpSynopsis: "List the registered contract ABIs",
+			HelpDescription: `
+			All the registered ABIs will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("abis/" + framework.GenericNameRegex("name")),
+			HelpSynopsis: "Register a contract ABI.",
+			HelpDescription: `
+
+Registers the JSON ABI of a contract by name. Sign requests can then send
+contract_abi=<name>, method and args instead of hex encoded data.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString},
+				"abi": {
+					Type:        framework.TypeString,
+					Description: "The JSON ABI of the contract, as produced by solc.",
+				},
+				"description": {
+					Type:        framework.TypeString,
+					Description: "A human readable description of the contract.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathABIRead,
+				logical.CreateOperation: b.pathABIWrite,
+				logical.UpdateOperation: b.pathABIWrite,
+				logical.DeleteOperation: b.pathABIDelete,
+			},
+		},
+	}
+}
+
+func abiPath(name string) string {
+	return QualifiedPath(fmt.Sprintf("abis/%s", name))
+}
+
+func readContractABI(ctx context.Context, s logical.Storage, name string) (*ContractABI, error) {
+	entry, err := s.Get(ctx, abiPath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var contractABI ContractABI
+	if err := entry.DecodeJSON(&contractABI); err != nil {
+		return nil, fmt.Errorf("failed to deserialize ABI %s: %v", name, err)
+	}
+	return &contractABI, nil
+}
+
+// parse decodes the JSON ABI
+func (contractABI *ContractABI) parse() (abi.ABI, error) {
+	return abi.JSON(strings.NewReader(contractABI.ABI))
+}
+
+func (b *vaultEthereumBackend) pathABIsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, QualifiedPath("abis/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *vaultEthereumBackend) pathABIRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	contractABI, err := readContractABI(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if contractABI == nil {
+		return nil, nil
+	}
+
+	parsed, err := contractABI.parse()
+	if err != nil {
+		return nil, err
+	}
+	methods := make(map[string]string, len(parsed.Methods))
+	for _, method := range parsed.Methods {
+		methods[method.Sig] = hexutil.Encode(method.ID)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"abi":         contractABI.ABI,
+			"description": contractABI.Description,
+			"methods":     methods,
+		},
+	}, nil
+}
+
+func (b *vaultEthereumBackend) pathABIWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	contractABI, err := readContractABI(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if contractABI == nil {
+		contractABI = &ContractABI{}
+	}
+
+	if raw, ok := data.GetOk("abi"); ok {
+		contractABI.ABI = raw.(string)
+	}
+	if description, ok := data.GetOk("description"); ok {
+		contractABI.Description = description.(string)
+	}
+
+	if contractABI.ABI == Empty {
+		return logical.ErrorResponse("abi not specified"), nil
+	}
+	if _, err := contractABI.parse(); err != nil {
+		return logical.ErrorResponse("invalid abi: %v", err), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(abiPath(name), contractABI)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	return b.pathABIRead(ctx, req, data)
+}
+
+func (b *vaultEthereumBackend) pathABIDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return nil, req.Storage.Delete(ctx, abiPath(data.Get("name").(string)))
+}
@@ -15,14 +15,20 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
 	"fmt"
 	"math/big"
+	"strings"
+	"time"
 
+	"github.com/bliiitz/vault-ethereum/util"
 	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	bip44 "github.com/miguelmota/go-ethereum-hdwallet"
 	"github.com/tyler-smith/go-bip39"
 
@@ -35,24 +41,65 @@ const (
 	DerivationPath string = "m/44'/60'/0'/0/%d"
 	// Empty is the empty string
 	Empty string = ""
+	// AccountTypeHD is an account derived from a BIP-39 mnemonic
+	AccountTypeHD string = "hd"
+	// AccountTypeKey is an account holding a single imported private key
+	AccountTypeKey string = "key"
+
+	// DefaultEntropyBits is the entropy of generated mnemonics (12 words)
+	DefaultEntropyBits int = 128
 )
 
 // AccountJSON is what we store for an Ethereum account
 type AccountJSON struct {
-	Index    int    `json:"index"`
-	Mnemonic string `json:"mnemonic"`
+	Type           string         `json:"type,omitempty"`
+	Address        string         `json:"address,omitempty"`
+	Index          int            `json:"index"`
+	DerivationPath string         `json:"derivation_path,omitempty"`
+	Mnemonic       string         `json:"mnemonic"`
+	Passphrase     string         `json:"bip39_passphrase,omitempty"`
+	PrivateKey     string         `json:"private_key,omitempty"`
+	Exportable     bool           `json:"exportable"`
+	Policy         *AccountPolicy `json:"policy,omitempty"`
+
+	// KeyVersion counts the rotations of the key, starting at 1
+	KeyVersion int `json:"key_version,omitempty"`
+
+	// Disabled is set while the account refuses to sign
+	Disabled *AccountDisabled `json:"disabled,omitempty"`
+
+	Description string    `json:"description,omitempty"`
+	Owner       string    `json:"owner,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
 }
 
+var (
+	// accountPattern matches the name of an account in a path
+	accountPattern = "accounts/" + framework.GenericNameRegex("name")
+	// accountIdentity holds the fields of accountPattern
+	accountIdentity = map[string]*framework.FieldSchema{
+		"name": {Type: framework.TypeString},
+	}
+)
+
 func accountPaths(b *vaultEthereumBackend) []*framework.Path {
-	return []*framework.Path{
+	return append([]*framework.Path{
 		{
 			Pattern: QualifiedPath("accounts/?"),
+			Fields: map[string]*framework.FieldSchema{
+				"tag": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Only list the accounts carrying all of these tags.",
+				},
+			},
 			Callbacks: map[logical.Operation]framework.OperationFunc{
 				logical.ListOperation: b.pathAccountsList,
 			},
 			HelpSynopsis: "List all the Ethereum accounts at a path",
 			HelpDescription: `
-			All the Ethereum accounts will be listed.
+			All the Ethereum accounts will be listed, along with their address
+			and metadata.
 			`,
 		},
 		{
@@ -60,9 +107,15 @@ func accountPaths(b *vaultEthereumBackend) []*framework.Path {
 			HelpSynopsis: "Create an Ethereum account using a generated or provided passphrase.",
 			HelpDescription: `
 
-Creates (or updates) an Ethereum account: an account controlled by a private key. Also
+Creates an Ethereum account: an account controlled by a private key. Also
 The generator produces a high-entropy passphrase with the provided length and requirements.
 
+Writing to an existing account only updates its description, owner and tags;
+its key cannot be changed, and its policy is managed under
+accounts/<name>/policy. With force=true the account is replaced instead, and
+the previous account is moved to deleted-accounts/<name>-replaced-<time>, from
+where it can be restored under that name.
+
 `,
 			Fields: map[string]*framework.FieldSchema{
 				"name": {Type: framework.TypeString},
@@ -71,66 +124,99 @@ The generator produces a high-entropy passphrase with the provided length and re
 					Default:     Empty,
 					Description: "The mnemonic to use to create the account. If not provided, one is generated.",
 				},
+				"entropy_bits": {
+					Type:        framework.TypeInt,
+					Default:     DefaultEntropyBits,
+					Description: "The entropy of a generated mnemonic: 128 (12 words) to 256 (24 words), in steps of 32.",
+				},
+				"bip39_passphrase": {
+					Type:        framework.TypeString,
+					Default:     Empty,
+					Description: "An optional BIP-39 passphrase (the 25th word) combined with the mnemonic to derive the seed.",
+				},
 				"index": {
 					Type:        framework.TypeInt,
 					Description: "The index used in BIP-44.",
 					Default:     0,
 				},
+				"derivation_path": {
+					Type:        framework.TypeString,
+					Default:     Empty,
+					Description: "The full BIP-32 derivation path (e.g. m/44'/60'/1'/0/0). Overrides index.",
+				},
+				"private_key": {
+					Type:        framework.TypeString,
+					Default:     Empty,
+					Description: "A hex encoded private key to import instead of a mnemonic.",
+				},
+				"keystore": {
+					Type:        framework.TypeString,
+					Default:     Empty,
+					Description: "A V3 JSON keystore to import instead of a mnemonic.",
+				},
+				"keystore_passphrase": {
+					Type:        framework.TypeString,
+					Default:     Empty,
+					Description: "The passphrase that decrypts the keystore.",
+				},
+				"exportable": {
+					Type:        framework.TypeBool,
+					Default:     false,
+					Description: "Whether the key may be exported as an encrypted keystore.",
+				},
+				"force": {
+					Type:        framework.TypeBool,
+					Default:     false,
+					Description: "Replace an existing account, moving it to deleted-accounts/, instead of failing.",
+				},
+				"description": metadataFields["description"],
+				"owner":       metadataFields["owner"],
+				"tags":        metadataFields["tags"],
 			},
 			ExistenceCheck: pathExistenceCheck,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
 				logical.ReadOperation:   b.pathAccountsRead,
 				logical.CreateOperation: b.pathAccountsCreate,
+				logical.UpdateOperation: b.pathAccountsUpdate,
 				logical.DeleteOperation: b.pathAccountsDelete,
 			},
 		},
+	}, signPaths(b, accountPattern, accountIdentity)...)
+}
+
+// withIdentity adds the fields naming the account to paths
+func withIdentity(paths []*framework.Path, identity map[string]*framework.FieldSchema) []*framework.Path {
+	for _, path := range paths {
+		for key, field := range identity {
+			path.Fields[key] = field
+		}
+	}
+	return paths
+}
+
+// signPaths returns the sign paths of the account matched by pattern. The
+// fields of identity name the account in the pattern.
+func signPaths(b *vaultEthereumBackend, pattern string, identity map[string]*framework.FieldSchema) []*framework.Path {
+	paths := []*framework.Path{
 		{
-			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/sign-1559-tx"),
+			Pattern:      QualifiedPath(pattern + "/sign-1559-tx"),
 			HelpSynopsis: "Sign a transaction.",
 			HelpDescription: `
 
 Sign an EIP 1559 transaction.
 
 `,
-			Fields: map[string]*framework.FieldSchema{
-				"name":    {Type: framework.TypeString},
-				"address": {Type: framework.TypeString},
-				"chain_id": {
-					Type:        framework.TypeInt64,
-					Description: "The chain ID of the tx to sign.",
-				},
-				"to": {
-					Type:        framework.TypeString,
-					Description: "The address of the wallet to send ETH to.",
-				},
-				"data": {
-					Type:        framework.TypeString,
-					Description: "The data to sign.",
-				},
-				"value": {
-					Type:        framework.TypeString,
-					Description: "Value of ETH (in wei).",
-				},
-				"nonce": {
-					Type:        framework.TypeInt64,
-					Description: "The transaction nonce.",
-				},
-				"gas_limit": {
-					Type:        framework.TypeString,
-					Description: "The gas limit for the transaction - defaults to 21000.",
-					Default:     "21000",
-				},
+			Fields: withFields(txFields(), map[string]*framework.FieldSchema{
 				"max_priority_fee_per_gas": {
 					Type:        framework.TypeString,
-					Description: "The gas price for the transaction in wei.",
-					Default:     "0",
+					Description: "The priority fee per gas in wei.",
 				},
 				"max_fee_per_gas": {
 					Type:        framework.TypeString,
-					Description: "The gas price for the transaction in wei.",
-					Default:     "0",
+					Description: "The maximum fee per gas in wei.",
 				},
-			},
+				"access_list": accessListField,
+			}),
 			ExistenceCheck: pathExistenceCheck,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
 				logical.CreateOperation: b.pathSignEIP1559Tx,
@@ -138,47 +224,34 @@ Sign an EIP 1559 transaction.
 			},
 		},
 		{
-			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/sign-tx"),
+			Pattern:      QualifiedPath(pattern + "/sign-2930-tx"),
 			HelpSynopsis: "Sign a transaction.",
 			HelpDescription: `
 
-Sign a transaction.
+Sign an EIP 2930 access list transaction.
 
 `,
-			Fields: map[string]*framework.FieldSchema{
-				"name":    {Type: framework.TypeString},
-				"address": {Type: framework.TypeString},
-				"chain_id": {
-					Type:        framework.TypeInt64,
-					Description: "The chain ID of the tx to sign.",
-				},
-				"to": {
-					Type:        framework.TypeString,
-					Description: "The address of the wallet to send ETH to.",
-				},
-				"data": {
-					Type:        framework.TypeString,
-					Description: "The data to sign.",
-				},
-				"value": {
-					Type:        framework.TypeString,
-					Description: "Value of ETH (in wei).",
-				},
-				"nonce": {
-					Type:        framework.TypeInt64,
-					Description: "The transaction nonce.",
-				},
-				"gas_limit": {
-					Type:        framework.TypeString,
-					Description: "The gas limit for the transaction - defaults to 21000.",
-					Default:     "21000",
-				},
-				"gas_price": {
-					Type:        framework.TypeString,
-					Description: "The gas price for the transaction in wei.",
-					Default:     "0",
-				},
+			Fields: withFields(txFields(), map[string]*framework.FieldSchema{
+				"gas_price":   gasPriceField,
+				"access_list": accessListField,
+			}),
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathSignEIP2930Tx,
+				logical.UpdateOperation: b.pathSignEIP2930Tx,
 			},
+		},
+		{
+			Pattern:      QualifiedPath(pattern + "/sign-tx"),
+			HelpSynopsis: "Sign a transaction.",
+			HelpDescription: `
+
+Sign a transaction.
+
+`,
+			Fields: withFields(txFields(), map[string]*framework.FieldSchema{
+				"gas_price": gasPriceField,
+			}),
 			ExistenceCheck: pathExistenceCheck,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
 				logical.CreateOperation: b.pathSignTx,
@@ -186,7 +259,7 @@ Sign a transaction.
 			},
 		},
 		{
-			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/sign"),
+			Pattern:      QualifiedPath(pattern + "/sign"),
 			HelpSynopsis: "Sign a message",
 			HelpDescription: `
 
@@ -197,11 +270,11 @@ https://eth.wiki/json-rpc/API#eth_sign
 
 		`,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
 				"message": {
 					Type:        framework.TypeString,
 					Description: "Message to sign.",
 				},
+				"legacy_v": legacyVField,
 			},
 			ExistenceCheck: pathExistenceCheck,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -209,7 +282,35 @@ https://eth.wiki/json-rpc/API#eth_sign
 				logical.UpdateOperation: b.pathSignMessage,
 			},
 		},
+		{
+			Pattern:      QualifiedPath(pattern + "/sign-typed-data"),
+			HelpSynopsis: "Sign EIP-712 typed structured data",
+			HelpDescription: `
+
+Sign calculates an ECDSA signature for:
+keccak256("\x19\x01" + domainSeparator + hashStruct(message)).
+
+The payload is the JSON object used by eth_signTypedData_v4, with the
+domain, types, primaryType and message keys.
+
+https://eips.ethereum.org/EIPS/eip-712
+
+		`,
+			Fields: map[string]*framework.FieldSchema{
+				"typed_data": {
+					Type:        framework.TypeString,
+					Description: "The EIP-712 payload (domain, types, primaryType and message) as JSON.",
+				},
+				"legacy_v": legacyVField,
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathSignTypedData,
+				logical.UpdateOperation: b.pathSignTypedData,
+			},
+		},
 	}
+	return withIdentity(paths, identity)
 }
 
 func (b *vaultEthereumBackend) pathAccountsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
@@ -217,7 +318,29 @@ func (b *vaultEthereumBackend) pathAccountsList(ctx context.Context, req *logica
 	if err != nil {
 		return nil, err
 	}
-	return logical.ListResponse(vals), nil
+	tags := data.Get("tag").([]string)
+
+	var keys []string
+	keyInfo := make(map[string]interface{}, len(vals))
+	for _, name := range vals {
+		accountJSON, err := readAccount(ctx, req, name)
+		if err != nil {
+			return nil, err
+		}
+		if accountJSON == nil || !accountJSON.hasTags(tags) {
+			continue
+		}
+		lastUsed, err := readLastUsed(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		info := accountJSON.metadata(lastUsed)
+		info["address"] = accountJSON.Address
+		info["disabled"] = accountJSON.Disabled != nil
+		keys = append(keys, name)
+		keyInfo[name] = info
+	}
+	return logical.ListResponseWithInfo(keys, keyInfo), nil
 }
 
 func readAccount(ctx context.Context, req *logical.Request, name string) (*AccountJSON, error) {
@@ -231,14 +354,96 @@ func readAccount(ctx context.Context, req *logical.Request, name string) (*Accou
 	}
 
 	var accountJSON AccountJSON
-	err = entry.DecodeJSON(&accountJSON)
-
-	if entry == nil {
-		return nil, fmt.Errorf("failed to deserialize account at %s", path)
+	if err := entry.DecodeJSON(&accountJSON); err != nil {
+		return nil, fmt.Errorf("failed to deserialize account at %s: %v", path, err)
 	}
 	return &accountJSON, nil
 }
 
+// loadAccount reads the account called name, which is either an account
+// under accounts/ or an account derived from a wallet, named <wallet>/<index>
+func loadAccount(ctx context.Context, req *logical.Request, name string) (*AccountJSON, error) {
+	if wallet, index, ok := parseWalletAccountName(name); ok {
+		return readWalletAccount(ctx, req.Storage, wallet, index)
+	}
+	return readAccount(ctx, req, name)
+}
+
+// requestAccountName returns the name of the account targeted by a request on
+// a path matched by accountPattern, by the pattern of the accounts of a
+// wallet or by the pattern of addresses/<address>. The error response is set
+// when no account has the address.
+func requestAccountName(ctx context.Context, s logical.Storage, data *framework.FieldData) (string, *logical.Response, error) {
+	if _, ok := data.Schema["wallet"]; ok {
+		return walletAccountName(data.Get("wallet").(string), data.Get("index").(int)), nil, nil
+	}
+	if _, ok := data.Schema["name"]; ok {
+		return data.Get("name").(string), nil, nil
+	}
+
+	address := data.Get("address").(string)
+	if !common.IsHexAddress(address) {
+		return Empty, logical.ErrorResponse("invalid address %s", address), nil
+	}
+	name, err := lookupAddress(ctx, s, common.HexToAddress(address))
+	if err != nil {
+		return Empty, nil, err
+	}
+	if name == Empty {
+		return Empty, logical.ErrorResponse("no account has address %s", address), nil
+	}
+	return name, nil, nil
+}
+
+// resolveAccount returns the name and the record of the account targeted by a
+// request on one of the paths built by signPaths: by name, by wallet and
+// index, or by address. When an account named in the path is also given an
+// address, the address must be the one of the account. The error response is
+// set when the account does not exist or does not match.
+func resolveAccount(ctx context.Context, req *logical.Request, data *framework.FieldData) (string, *AccountJSON, *logical.Response, error) {
+	name, resp, err := requestAccountName(ctx, req.Storage, data)
+	if resp != nil || err != nil {
+		return Empty, nil, resp, err
+	}
+
+	accountJSON, err := loadAccount(ctx, req, name)
+	if err != nil {
+		return Empty, nil, nil, err
+	}
+	if accountJSON == nil {
+		return Empty, nil, logical.ErrorResponse("account %s does not exist", name), nil
+	}
+	_, byWallet := data.Schema["wallet"]
+	_, byName := data.Schema["name"]
+	if address, ok := data.GetOk("address"); ok && (byWallet || byName) && address.(string) != Empty {
+		if !common.IsHexAddress(address.(string)) {
+			return Empty, nil, logical.ErrorResponse("invalid address %s", address), nil
+		}
+		key, accountAddress, err := getAccountKey(*accountJSON)
+		if err != nil {
+			return Empty, nil, nil, err
+		}
+		util.ZeroKey(key)
+		if accountAddress != common.HexToAddress(address.(string)) {
+			return Empty, nil, logical.ErrorResponse("account %s has address %s, not %s", name, accountAddress.Hex(), address), nil
+		}
+	}
+	return name, accountJSON, nil, nil
+}
+
+// resolveSigner is resolveAccount for the operations signing with the key of
+// the account, which a disabled account refuses
+func resolveSigner(ctx context.Context, req *logical.Request, data *framework.FieldData) (string, *AccountJSON, *logical.Response, error) {
+	name, accountJSON, resp, err := resolveAccount(ctx, req, data)
+	if resp != nil || err != nil {
+		return Empty, nil, resp, err
+	}
+	if accountJSON.Disabled != nil {
+		return Empty, nil, disabledResponse(name, accountJSON.Disabled), nil
+	}
+	return name, accountJSON, nil, nil
+}
+
 func (b *vaultEthereumBackend) pathAccountsRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 
 	name := data.Get("name").(string)
@@ -247,19 +452,34 @@ func (b *vaultEthereumBackend) pathAccountsRead(ctx context.Context, req *logica
 		return nil, err
 	}
 
-	_, account, err := getWalletAndAccount(*accountJSON)
+	if accountJSON == nil {
+		return nil, nil
+	}
+
+	key, address, err := getAccountKey(*accountJSON)
 	if err != nil {
 		return nil, err
 	}
-	if err != nil || accountJSON == nil {
-		return nil, fmt.Errorf("Error reading account")
+	util.ZeroKey(key)
+
+	lastUsed, err := readLastUsed(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
 	}
 
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"address": account.Address.Hex(),
-		},
-	}, nil
+	response := &logical.Response{
+		Data: accountJSON.metadata(lastUsed),
+	}
+	response.Data["address"] = address.Hex()
+	response.Data["type"] = accountJSON.accountType()
+	response.Data["exportable"] = accountJSON.Exportable
+	response.Data["disabled"] = accountJSON.Disabled.data()
+	response.Data["key_version"] = accountJSON.keyVersion()
+	if accountJSON.accountType() == AccountTypeHD {
+		response.Data["derivation_path"] = accountJSON.derivationPath()
+		response.Data["bip39_passphrase_set"] = accountJSON.Passphrase != Empty
+	}
+	return response, nil
 }
 
 func (b *vaultEthereumBackend) pathAccountsDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
@@ -269,19 +489,39 @@ func (b *vaultEthereumBackend) pathAccountsDelete(ctx context.Context, req *logi
 	if err != nil {
 		return nil, err
 	}
-	if err := req.Storage.Delete(ctx, req.Path); err != nil {
-		return nil, err
+	return nil, b.deleteAccount(ctx, req.Storage, name, req.DisplayName)
+}
+
+// accountType returns the kind of key material held by the account. Records
+// written before imported keys were supported are always HD accounts.
+func (accountJSON AccountJSON) accountType() string {
+	if accountJSON.Type == Empty {
+		return AccountTypeHD
+	}
+	return accountJSON.Type
+}
+
+// derivationPath returns the BIP-32 path of the account. Records written
+// before paths were configurable only carry an index into DerivationPath.
+func (accountJSON AccountJSON) derivationPath() string {
+	if accountJSON.DerivationPath != Empty {
+		return accountJSON.DerivationPath
 	}
-	return nil, nil
+	return fmt.Sprintf(DerivationPath, accountJSON.Index)
 }
 
 func getWalletAndAccount(accountJSON AccountJSON) (*bip44.Wallet, *accounts.Account, error) {
-	hdwallet, err := bip44.NewFromMnemonic(accountJSON.Mnemonic)
+	if !bip39.IsMnemonicValid(accountJSON.Mnemonic) {
+		return nil, nil, fmt.Errorf("mnemonic is invalid")
+	}
+	hdwallet, err := bip44.NewFromSeed(bip39.NewSeed(accountJSON.Mnemonic, accountJSON.Passphrase))
+	if err != nil {
+		return nil, nil, err
+	}
+	path, err := bip44.ParseDerivationPath(accountJSON.derivationPath())
 	if err != nil {
 		return nil, nil, err
 	}
-	derivationPath := fmt.Sprintf(DerivationPath, accountJSON.Index)
-	path := bip44.MustParseDerivationPath(derivationPath)
 	account, err := hdwallet.Derive(path, true)
 	if err != nil {
 		return nil, nil, err
@@ -289,40 +529,247 @@ func getWalletAndAccount(accountJSON AccountJSON) (*bip44.Wallet, *accounts.Acco
 	return hdwallet, &account, nil
 }
 
+// getAccountKey returns the private key that signs for the account along with
+// its address. Callers should zero the key once they are done with it.
+func getAccountKey(accountJSON AccountJSON) (*ecdsa.PrivateKey, common.Address, error) {
+	switch accountJSON.accountType() {
+	case AccountTypeHD:
+		wallet, account, err := getWalletAndAccount(accountJSON)
+		if err != nil {
+			return nil, common.Address{}, err
+		}
+		key, err := wallet.PrivateKey(*account)
+		if err != nil {
+			return nil, common.Address{}, err
+		}
+		return key, account.Address, nil
+	case AccountTypeKey:
+		key, err := crypto.HexToECDSA(accountJSON.PrivateKey)
+		if err != nil {
+			return nil, common.Address{}, err
+		}
+		return key, crypto.PubkeyToAddress(key.PublicKey), nil
+	default:
+		return nil, common.Address{}, fmt.Errorf("unknown account type %s", accountJSON.Type)
+	}
+}
+
+// importAccountKey decodes a private key supplied either as hex or as a V3
+// JSON keystore
+func importAccountKey(privateKey string, keystoreJSON string, passphrase string) (*ecdsa.PrivateKey, error) {
+	if privateKey != Empty && keystoreJSON != Empty {
+		return nil, fmt.Errorf("private_key and keystore are mutually exclusive")
+	}
+	if keystoreJSON != Empty {
+		return util.ImportJSONKeystore([]byte(keystoreJSON), passphrase)
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(privateKey, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private_key: %v", err)
+	}
+	return key, nil
+}
+
 func (b *vaultEthereumBackend) pathAccountsCreate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 
 	name := data.Get("name").(string)
 	index := data.Get("index").(int)
+	derivationPath := data.Get("derivation_path").(string)
 	mnemonic := data.Get("mnemonic").(string)
+	privateKey := data.Get("private_key").(string)
+	keystoreJSON := data.Get("keystore").(string)
+	passphrase := data.Get("bip39_passphrase").(string)
+	exportable := data.Get("exportable").(bool)
+
+	deleted, err := readDeletedAccount(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if deleted != nil {
+		return logical.ErrorResponse("account %s was deleted; restore or purge deleted-accounts/%s first", name, name), nil
+	}
+	existing, err := readAccount(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && !data.Get("force").(bool) {
+		return logical.ErrorResponse("account %s already exists; set force=true to replace it", name), nil
+	}
+
+	if privateKey != Empty || keystoreJSON != Empty {
+		if mnemonic != Empty || passphrase != Empty {
+			return logical.ErrorResponse("mnemonic and bip39_passphrase cannot be combined with an imported key"), nil
+		}
+		key, err := importAccountKey(privateKey, keystoreJSON, data.Get("keystore_passphrase").(string))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		defer util.ZeroKey(key)
+
+		address := crypto.PubkeyToAddress(key.PublicKey)
+		accountJSON := &AccountJSON{
+			Type:       AccountTypeKey,
+			Address:    address.Hex(),
+			PrivateKey: hex.EncodeToString(crypto.FromECDSA(key)),
+			Exportable: exportable,
+			CreatedAt:  time.Now().UTC(),
+		}
+		applyMetadata(accountJSON, data)
+		return b.writeNewAccount(ctx, req, name, existing, accountJSON, address)
+	}
+
+	if derivationPath != Empty {
+		if _, ok := data.GetOk("index"); ok {
+			return logical.ErrorResponse("index and derivation_path are mutually exclusive"), nil
+		}
+		if _, err := bip44.ParseDerivationPath(derivationPath); err != nil {
+			return logical.ErrorResponse("invalid derivation_path: %v", err), nil
+		}
+	}
 
 	if mnemonic == Empty {
-		entropy, err := bip39.NewEntropy(128)
+		entropyBits := data.Get("entropy_bits").(int)
+		if !validEntropyBits(entropyBits) {
+			return logical.ErrorResponse("entropy_bits must be 128, 160, 192, 224 or 256"), nil
+		}
+		var err error
+		mnemonic, err = generateMnemonic(entropyBits)
 		if err != nil {
 			return nil, err
 		}
-
-		mnemonic, err = bip39.NewMnemonic(entropy)
+	} else if _, ok := data.GetOk("entropy_bits"); ok {
+		return logical.ErrorResponse("entropy_bits cannot be combined with a mnemonic"), nil
 	}
 
 	accountJSON := &AccountJSON{
-		Index:    index,
-		Mnemonic: mnemonic,
+		Type:           AccountTypeHD,
+		Index:          index,
+		DerivationPath: derivationPath,
+		Mnemonic:       mnemonic,
+		Passphrase:     passphrase,
+		Exportable:     exportable,
+		CreatedAt:      time.Now().UTC(),
 	}
-	_, account, err := getWalletAndAccount(*accountJSON)
+	applyMetadata(accountJSON, data)
+	key, address, err := getAccountKey(*accountJSON)
 	if err != nil {
-		return nil, err
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	util.ZeroKey(key)
+	accountJSON.Address = address.Hex()
+
+	return b.writeNewAccount(ctx, req, name, existing, accountJSON, address)
+}
+
+// keyFields are the fields of an account creation that set its key
+var keyFields = []string{
+	"mnemonic",
+	"entropy_bits",
+	"bip39_passphrase",
+	"index",
+	"derivation_path",
+	"private_key",
+	"keystore",
+	"keystore_passphrase",
+	"exportable",
+}
+
+// pathAccountsUpdate changes the metadata of an existing account. Its key is
+// only replaced when force is set.
+func (b *vaultEthereumBackend) pathAccountsUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if data.Get("force").(bool) {
+		return b.pathAccountsCreate(ctx, req, data)
+	}
+	for _, field := range keyFields {
+		if _, ok := data.GetOk(field); ok {
+			return logical.ErrorResponse("%s cannot be changed on an existing account; rotate its key or set force=true to replace it", field), nil
+		}
 	}
 
-	err = b.updateAccount(ctx, req, name, accountJSON)
+	name := data.Get("name").(string)
+	accountJSON, err := readAccount(ctx, req, name)
 	if err != nil {
 		return nil, err
 	}
+	if accountJSON == nil {
+		return logical.ErrorResponse("account %s does not exist", name), nil
+	}
+	applyMetadata(accountJSON, data)
+	if err := b.updateAccount(ctx, req, name, accountJSON); err != nil {
+		return nil, err
+	}
+	return b.pathAccountsRead(ctx, req, data)
+}
 
-	return &logical.Response{
+// writeNewAccount stores a created account, indexes its address and
+// describes it. The account it replaces, if any, is moved to
+// deleted-accounts/<name>-replaced-<time>, from where it can be restored until
+// the retention period ends.
+func (b *vaultEthereumBackend) writeNewAccount(ctx context.Context, req *logical.Request, name string, existing *AccountJSON, accountJSON *AccountJSON, address common.Address) (*logical.Response, error) {
+	resp := &logical.Response{
 		Data: map[string]interface{}{
-			"address": account.Address.Hex(),
+			"address": address.Hex(),
 		},
-	}, nil
+	}
+	if resp, err := addressConflict(ctx, req.Storage, address, name); resp != nil || err != nil {
+		return resp, err
+	}
+	if existing != nil {
+		previousAddress, err := accountAddress(existing)
+		if err != nil {
+			return nil, err
+		}
+		deletedName, err := replacedAccountName(ctx, req, name)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.archiveAccount(ctx, req.Storage, name, deletedName, req.DisplayName); err != nil {
+			return nil, err
+		}
+		b.Logger().Warn("account replaced", "account", name, "previous_address", previousAddress.Hex(), "address", address.Hex(), "deleted_account", deletedName, "actor", req.DisplayName)
+		resp.Data["previous_address"] = previousAddress.Hex()
+		resp.Data["deleted_account"] = deletedName
+	}
+	if err := b.updateAccount(ctx, req, name, accountJSON); err != nil {
+		return nil, err
+	}
+	if resp, err := indexAddress(ctx, req.Storage, address, name); resp != nil || err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// replacedAccountName returns a name, free among both the accounts and the
+// deleted accounts, to keep the account called name under once replaced
+func replacedAccountName(ctx context.Context, req *logical.Request, name string) (string, error) {
+	for suffix := time.Now().Unix(); ; suffix++ {
+		replacedName := fmt.Sprintf("%s-replaced-%d", name, suffix)
+		deleted, err := readDeletedAccount(ctx, req.Storage, replacedName)
+		if err != nil {
+			return Empty, err
+		}
+		accountJSON, err := readAccount(ctx, req, replacedName)
+		if err != nil {
+			return Empty, err
+		}
+		if deleted == nil && accountJSON == nil {
+			return replacedName, nil
+		}
+	}
+}
+
+// validEntropyBits reports whether bits is a BIP-39 entropy size
+func validEntropyBits(bits int) bool {
+	return bits >= 128 && bits <= 256 && bits%32 == 0
+}
+
+// generateMnemonic returns a new BIP-39 mnemonic with the given entropy
+func generateMnemonic(entropyBits int) (string, error) {
+	entropy, err := bip39.NewEntropy(entropyBits)
+	if err != nil {
+		return Empty, err
+	}
+	return bip39.NewMnemonic(entropy)
 }
 
 func (b *vaultEthereumBackend) updateAccount(ctx context.Context, req *logical.Request, name string, accountJSON *AccountJSON) error {
@@ -352,114 +799,203 @@ func pathExistenceCheck(ctx context.Context, req *logical.Request, data *framewo
 // returns (nonce, toAddress, amount, gasPrice, gasLimit, error)
 
 func (b *vaultEthereumBackend) pathSignEIP1559Tx(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.signTxRequest(ctx, req, data, getEIP1559TransactionData)
+}
 
-	var err error
+func (b *vaultEthereumBackend) pathSignEIP2930Tx(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.signTxRequest(ctx, req, data, getEIP2930TransactionData)
+}
 
-	name := data.Get("name").(string)
+func (b *vaultEthereumBackend) pathSignTx(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.signTxRequest(ctx, req, data, func(data *framework.FieldData, chainID *big.Int) (*types.Transaction, error) {
+		return getTransactionData(data)
+	})
+}
 
-	accountJSON, err := readAccount(ctx, req, name)
-	if err != nil {
-		return nil, err
+// LogTx is for debugging
+func (b *vaultEthereumBackend) LogTx(tx *types.Transaction) {
+	b.Logger().Info(fmt.Sprintf("\nTX DATA: %s\nGAS: %d\nGAS PRICE: %d\nVALUE: %d\nNONCE: %d\nTO: %s\nCHAINID: %d\n", hexutil.Encode(tx.Data()), tx.Gas(), tx.GasPrice(), tx.Value(), tx.Nonce(), tx.To(), tx.ChainId()))
+}
+
+func (b *vaultEthereumBackend) pathSignMessage(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	message := data.Get("message").(string)
+
+	name, accountJSON, resp, err := resolveSigner(ctx, req, data)
+	if resp != nil || err != nil {
+		return resp, err
 	}
 
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	key, address, err := getAccountKey(*accountJSON)
 	if err != nil {
 		return nil, err
 	}
+	defer util.ZeroKey(key)
+
+	hashedMessage, _ := accounts.TextAndHash([]byte(message))
 
-	tx, err := getEIP1559TransactionData(data)
+	signedMessage, err := crypto.Sign([]byte(hashedMessage), key)
 	if err != nil {
 		return nil, err
 	}
+	withLegacyV(data, signedMessage)
 
-	signedTx, err := wallet.SignTx(*account, tx, tx.ChainId())
-	if err != nil {
+	if err := touchAccount(ctx, req.Storage, name); err != nil {
 		return nil, err
 	}
 
-	var signedTxBuff bytes.Buffer
-	signedTx.EncodeRLP(&signedTxBuff)
-
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"chainId":           tx.ChainId(),
-			"signedTransaction": signedTx,
-			"rlpSignature":      hexutil.Encode(signedTxBuff.Bytes()),
+			"signature":     hexutil.Encode(signedMessage),
+			"address":       address,
+			"hashedMessage": hexutil.Encode(hashedMessage),
 		},
 	}, nil
 }
 
-func (b *vaultEthereumBackend) pathSignTx(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-
-	var err error
+func (b *vaultEthereumBackend) pathSignTypedData(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	typedData, err := parseTypedData(data.Get("typed_data").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
 
-	name := data.Get("name").(string)
+	name, accountJSON, resp, err := resolveSigner(ctx, req, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
 
-	accountJSON, err := readAccount(ctx, req, name)
+	key, address, err := getAccountKey(*accountJSON)
 	if err != nil {
 		return nil, err
 	}
+	defer util.ZeroKey(key)
 
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	digest, domainSeparator, _, err := hashTypedData(typedData)
 	if err != nil {
-		return nil, err
+		return logical.ErrorResponse(err.Error()), nil
 	}
 
-	tx, err := getTransactionData(data)
+	signature, err := crypto.Sign(digest, key)
 	if err != nil {
 		return nil, err
 	}
 
-	chainId := data.Get("chain_id").(int64)
-	bigChainID := new(big.Int).SetInt64(chainId)
-	signedTx, err := wallet.SignTxEIP155(*account, tx, bigChainID)
+	publicKey, err := crypto.SigToPub(digest, signature)
 	if err != nil {
 		return nil, err
 	}
+	recovered := crypto.PubkeyToAddress(*publicKey)
+	if recovered != address {
+		return nil, fmt.Errorf("recovered address %s does not match account address %s", recovered.Hex(), address.Hex())
+	}
+
+	if err := touchAccount(ctx, req.Storage, name); err != nil {
+		return nil, err
+	}
 
-	var signedTxBuff bytes.Buffer
-	signedTx.EncodeRLP(&signedTxBuff)
+	withLegacyV(data, signature)
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"chainId":           bigChainID,
-			"signedTransaction": signedTx,
-			"rlpSignature":      hexutil.Encode(signedTxBuff.Bytes()),
+			"signature":       hexutil.Encode(signature),
+			"digest":          hexutil.Encode(digest),
+			"domainSeparator": hexutil.Encode(domainSeparator),
+			"address":         recovered.Hex(),
 		},
 	}, nil
 }
 
-// LogTx is for debugging
-func (b *vaultEthereumBackend) LogTx(tx *types.Transaction) {
-	b.Logger().Info(fmt.Sprintf("\nTX DATA: %s\nGAS: %d\nGAS PRICE: %d\nVALUE: %d\nNONCE: %d\nTO: %s\nCHAINID: %d\n", hexutil.Encode(tx.Data()), tx.Gas(), tx.GasPrice(), tx.Value(), tx.Nonce(), tx.To(), tx.ChainId()))
+// txFields returns the fields shared by the paths that sign a transaction
+func txFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"address": {
+			Type:        framework.TypeString,
+			Description: "The expected address of the account. The request fails if the account has another address.",
+		},
+		"chain_id": {
+			Type:        framework.TypeInt64,
+			Description: "The chain ID of the tx to sign.",
+		},
+		"chain": {
+			Type:        framework.TypeString,
+			Description: "The name of a registered chain to use instead of chain_id.",
+		},
+		"to": {
+			Type:        framework.TypeString,
+			Description: "The address of the wallet to send ETH to. Omit to deploy a contract.",
+		},
+		"data": {
+			Type:        framework.TypeString,
+			Description: "The data to sign.",
+		},
+		"contract_abi": {
+			Type:        framework.TypeString,
+			Description: "The name of a registered ABI used to encode method and args into data.",
+		},
+		"method": {
+			Type:        framework.TypeString,
+			Description: "The contract method to call, by name or by signature for overloaded methods.",
+		},
+		"args": {
+			Type:        framework.TypeString,
+			Description: "The method arguments as a JSON list, or an object keyed by argument name.",
+		},
+		"bytecode": {
+			Type:        framework.TypeString,
+			Description: "The bytecode of a contract to deploy, with to omitted.",
+		},
+		"constructor_args": {
+			Type:        framework.TypeString,
+			Description: "The ABI-encoded constructor arguments appended to the bytecode.",
+		},
+		"value": {
+			Type:        framework.TypeString,
+			Description: "Value of ETH (in wei).",
+		},
+		"nonce": {
+			Type:        framework.TypeInt64,
+			Description: "The transaction nonce. If omitted, it is allocated by the nonce manager of the account.",
+		},
+		"gas_limit": {
+			Type:        framework.TypeString,
+			Description: "The gas limit for the transaction - defaults to 21000.",
+			Default:     "21000",
+		},
+	}
 }
 
-func (b *vaultEthereumBackend) pathSignMessage(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	message := data.Get("message").(string)
-	name := data.Get("name").(string)
-
-	accountJSON, err := readAccount(ctx, req, name)
-	if err != nil {
-		return nil, err
+// withFields adds the fields of a transaction type to the shared fields,
+// replacing the shared fields of the same name
+func withFields(fields map[string]*framework.FieldSchema, extra map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	for name, field := range extra {
+		fields[name] = field
 	}
+	return fields
+}
 
-	wallet, account, err := getWalletAndAccount(*accountJSON)
-	if err != nil {
-		return nil, err
-	}
+// gasPriceField is the gas price of legacy and access list transactions
+var gasPriceField = &framework.FieldSchema{
+	Type:        framework.TypeString,
+	Description: "The gas price for the transaction in wei.",
+}
 
-	hashedMessage, _ := accounts.TextAndHash([]byte(message))
+// accessListField is the access list of typed transactions
+var accessListField = &framework.FieldSchema{
+	Type:        framework.TypeString,
+	Description: "The access list as JSON: [{\"address\": \"0x...\", \"storageKeys\": [\"0x...\"]}].",
+}
 
-	signedMessage, err := wallet.SignHash(*account, []byte(hashedMessage))
-	if err != nil {
-		return nil, err
-	}
+// legacyVField selects the recovery id convention of the signatures returned
+// by sign and sign-typed-data
+var legacyVField = &framework.FieldSchema{
+	Type:        framework.TypeBool,
+	Default:     false,
+	Description: "Return v as 27/28, as ecrecover and eth_sign do, instead of the raw 0/1 recovery id.",
+}
 
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"signature":     hexutil.Encode(signedMessage),
-			"address":       account.Address,
-			"hashedMessage": hexutil.Encode(hashedMessage),
-		},
-	}, nil
+// withLegacyV shifts the recovery id of signature to 27/28 when the request
+// sets legacy_v
+func withLegacyV(data *framework.FieldData, signature []byte) {
+	if data.Get("legacy_v").(bool) {
+		signature[crypto.RecoveryIDOffset] += 27
+	}
 }
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestAccountDerivationPath(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	cases := []struct {
+		name  string
+		data  map[string]interface{}
+		path  string
+		wants string
+	}{
+		{"default", map[string]interface{}{}, "m/44'/60'/0'/0/0", testAddress},
+		{"index", map[string]interface{}{"index": 1}, "m/44'/60'/0'/0/1", "0x70997970C51812dc3A010C7d01b50e0d17dc79C8"},
+		{"path", map[string]interface{}{"derivation_path": "m/44'/60'/0'/0/2"}, "m/44'/60'/0'/0/2", "0x3C44CdDdB6a900fa2b585dd299e03d12FA4293BC"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.data["mnemonic"] = testMnemonic
+			resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/"+c.name, c.data))
+			if resp.Data["address"] != c.wants {
+				t.Fatalf("expected address %s, got %v", c.wants, resp.Data["address"])
+			}
+			resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/"+c.name, nil))
+			if resp.Data["address"] != c.wants || resp.Data["derivation_path"] != c.path {
+				t.Fatalf("expected %s at %s, got %v", c.wants, c.path, resp.Data)
+			}
+		})
+	}
+}
+
+func TestAccountDerivationPathRejectsInvalidPaths(t *testing.T) {
+	b, s := getTestBackend(t)
+	for _, data := range []map[string]interface{}{
+		{"derivation_path": "m/44'/60'/x"},
+		{"derivation_path": "m/44'/60'/0'/0/0", "index": 1},
+	} {
+		data["mnemonic"] = testMnemonic
+		mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test", data))
+	}
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test", map[string]interface{}{
+		"mnemonic": "not a valid mnemonic",
+	}))
+}
+
+// cowKey is the private key signing the Mail example of EIP-712
+var cowKey = crypto.Keccak256([]byte("cow"))
+
+func TestAccountImportPrivateKey(t *testing.T) {
+	b, s := getTestBackend(t)
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/cow", map[string]interface{}{
+		"private_key": hexutil.Encode(cowKey),
+	}))
+	if resp.Data["address"] != "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826" {
+		t.Fatalf("expected the address of the cow key, got %v", resp.Data["address"])
+	}
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/cow", nil))
+	if resp.Data["type"] != AccountTypeKey || resp.Data["derivation_path"] != nil {
+		t.Fatalf("expected an imported key without derivation path, got %v", resp.Data)
+	}
+
+	// The signature of the Mail example in EIP-712
+	resp = mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/cow/sign-typed-data", map[string]interface{}{
+		"typed_data": mailTypedData,
+		"legacy_v":   true,
+	}))
+	want := "0x4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b915621c"
+	if resp.Data["signature"] != want {
+		t.Fatalf("expected signature %s, got %v", want, resp.Data["signature"])
+	}
+}
+
+// testKeystore encrypts key with passphrase using light scrypt parameters
+func testKeystore(t *testing.T, key []byte, passphrase string) map[string]interface{} {
+	t.Helper()
+	privateKey, err := crypto.ToECDSA(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := uuid.NewRandom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := keystore.EncryptKey(&keystore.Key{
+		Id:         id,
+		Address:    crypto.PubkeyToAddress(privateKey.PublicKey),
+		PrivateKey: privateKey,
+	}, passphrase, keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(encrypted, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestAccountImportKeystore(t *testing.T) {
+	b, s := getTestBackend(t)
+	encoded, err := json.Marshal(testKeystore(t, cowKey, "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/wrong", map[string]interface{}{
+		"keystore":            string(encoded),
+		"keystore_passphrase": "not the secret",
+	}))
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/cow", map[string]interface{}{
+		"keystore":            string(encoded),
+		"keystore_passphrase": "secret",
+	}))
+	if resp.Data["address"] != "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826" {
+		t.Fatalf("expected the address of the cow key, got %v", resp.Data["address"])
+	}
+}
+
+func TestAccountImportRejectsCostlyKeystores(t *testing.T) {
+	b, s := getTestBackend(t)
+	for param, value := range map[string]float64{
+		"n":     keystore.StandardScryptN * 2,
+		"p":     128,
+		"r":     16,
+		"dklen": 64,
+	} {
+		t.Run(param, func(t *testing.T) {
+			ks := testKeystore(t, cowKey, "secret")
+			ks["crypto"].(map[string]interface{})["kdfparams"].(map[string]interface{})[param] = value
+			encoded, err := json.Marshal(ks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/cow", map[string]interface{}{
+				"keystore":            string(encoded),
+				"keystore_passphrase": "secret",
+			}))
+			if !strings.Contains(resp.Error().Error(), "exceed") {
+				t.Fatalf("expected the %s parameter to be refused, got %v", param, resp.Error())
+			}
+		})
+	}
+}
+
+func TestAccountImportRejectsConflictingKeys(t *testing.T) {
+	b, s := getTestBackend(t)
+	for _, data := range []map[string]interface{}{
+		{"private_key": "not hex"},
+		{"private_key": hexutil.Encode(cowKey), "mnemonic": testMnemonic},
+		{"private_key": hexutil.Encode(cowKey), "keystore": "{}"},
+	} {
+		mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test", data))
+	}
+}
+
+func TestSignTxEncodesTypedTransactions(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/sign-1559-tx", map[string]interface{}{
+		"chain_id":                 1,
+		"to":                       testRecipient,
+		"nonce":                    0,
+		"gas_limit":                "21000",
+		"max_priority_fee_per_gas": "1",
+		"max_fee_per_gas":          "2",
+	}))
+	if rawTx := resp.Data["rlpSignature"].(string); !strings.HasPrefix(rawTx, "0x02") {
+		t.Fatalf("expected the EIP-2718 encoding 0x02 || rlp(tx), got %s", rawTx)
+	}
+	if tx := signedTransaction(t, resp); tx.Type() != types.DynamicFeeTxType {
+		t.Fatalf("expected an EIP-1559 transaction, got type %d", tx.Type())
+	}
+
+	if tx := signedTransaction(t, signTx(t, b, s, "test", "1", nil)); tx.Type() != types.LegacyTxType || tx.ChainId().Int64() != 1 {
+		t.Fatalf("expected a legacy transaction on chain 1, got type %d on chain %s", tx.Type(), tx.ChainId())
+	}
+}
+
+func TestAccountBIP39Passphrase(t *testing.T) {
+	b, s := getTestBackend(t)
+	data := map[string]interface{}{"mnemonic": testMnemonic, "bip39_passphrase": "TREZOR"}
+
+	first := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/first", data))
+	request(t, b, s, logical.DeleteOperation, "accounts/first", nil)
+	second := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/second", data))
+	if first.Data["address"] == testAddress || first.Data["address"] != second.Data["address"] {
+		t.Fatalf("expected the passphrase to derive another address, got %v and %v", first.Data["address"], second.Data["address"])
+	}
+
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/second", nil))
+	if resp.Data["bip39_passphrase_set"] != true || resp.Data["address"] != second.Data["address"] {
+		t.Fatalf("unexpected account %v", resp.Data)
+	}
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/imported", map[string]interface{}{
+		"private_key":      hexutil.Encode(cowKey),
+		"bip39_passphrase": "TREZOR",
+	}))
+}
+
+func TestAccountEntropyBits(t *testing.T) {
+	b, s := getTestBackend(t)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test", map[string]interface{}{
+		"entropy_bits": 256,
+	}))
+	accountJSON, err := readAccount(context.Background(), &logical.Request{Storage: s}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if words := len(strings.Fields(accountJSON.Mnemonic)); words != 24 {
+		t.Fatalf("expected a 24 word mnemonic, got %d words", words)
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"entropy_bits": 64},
+		{"entropy_bits": 200},
+		{"entropy_bits": 160, "mnemonic": testMnemonic},
+	} {
+		mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/other", data))
+	}
+}
+
+func TestAccountReadMissing(t *testing.T) {
+	b, s := getTestBackend(t)
+	if resp := request(t, b, s, logical.ReadOperation, "accounts/missing", nil); resp != nil {
+		t.Fatalf("expected no account, got %v", resp.Data)
+	}
+
+	if err := s.Put(context.Background(), &logical.StorageEntry{Key: "accounts/corrupt", Value: []byte("{")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "accounts/corrupt",
+		Storage:   s,
+	}); err == nil {
+		t.Fatal("expected an error reading a corrupt account")
+	}
+}
+
+func TestAccountUpdateKeepsKey(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	for _, data := range []map[string]interface{}{
+		{"private_key": hexutil.Encode(cowKey)},
+		{"mnemonic": testMnemonic},
+		{"exportable": true},
+	} {
+		mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test", data))
+	}
+
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test", map[string]interface{}{
+		"description": "treasury",
+	}))
+	if resp.Data["address"] != testAddress || resp.Data["description"] != "treasury" {
+		t.Fatalf("expected only the description to change, got %v", resp.Data)
+	}
+}
+
+func TestAccountForceReplace(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/nonces/1", map[string]interface{}{
+		"next": 7,
+	}))
+
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test", map[string]interface{}{
+		"private_key": hexutil.Encode(cowKey),
+		"force":       true,
+	}))
+	replaced := resp.Data["deleted_account"].(string)
+	if resp.Data["address"] != cowAddress || resp.Data["previous_address"] != testAddress || !strings.HasPrefix(replaced, "test-replaced-") {
+		t.Fatalf("unexpected replacement %v", resp.Data)
+	}
+	if resp := request(t, b, s, logical.ReadOperation, "accounts/test/nonces/1", nil); resp != nil {
+		t.Fatalf("expected the counter to move with the previous account, got %v", resp.Data)
+	}
+	if resp := request(t, b, s, logical.ReadOperation, "addresses/"+testAddress, nil); resp != nil {
+		t.Fatalf("expected the previous address to be unindexed, got %v", resp.Data)
+	}
+
+	// the previous account is restored under its new name
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "deleted-accounts/"+replaced+"/restore", nil))
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "addresses/"+testAddress, nil))
+	if resp.Data["account"] != replaced {
+		t.Fatalf("expected the previous address to belong to %s, got %v", replaced, resp.Data)
+	}
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/"+replaced+"/nonces/1", nil))
+	if resp.Data["next"] != uint64(7) {
+		t.Fatalf("expected the counter to be restored, got %v", resp.Data)
+	}
+
+	// a key held by another account is refused before anything is replaced
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test", map[string]interface{}{
+		"mnemonic": testMnemonic,
+		"force":    true,
+	}))
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/test", nil))
+	if resp.Data["address"] != cowAddress {
+		t.Fatalf("expected the account to be kept, got %v", resp.Data)
+	}
+	if resp := request(t, b, s, logical.ListOperation, "deleted-accounts/", nil); resp.Data["keys"] != nil {
+		t.Fatalf("expected no other deleted account, got %v", resp.Data)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bliiitz/vault-ethereum/util"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// AddressEntry maps an address to the account holding its key
+type AddressEntry struct {
+	Account string `json:"account"`
+}
+
+func addressPaths(b *vaultEthereumBackend) []*framework.Path {
+	pattern := "addresses/" + `(?P<address>0[xX][0-9a-fA-F]{40})`
+	identity := map[string]*framework.FieldSchema{
+		"address": {
+			Type:        framework.TypeString,
+			Description: "The address of the account.",
+		},
+	}
+
+	paths := []*framework.Path{
+		{
+			Pattern: QualifiedPath("addresses/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathAddressesList,
+			},
+			HelpSynopsis: "List the addresses of the accounts",
+			HelpDescription: `
+			All the indexed addresses will be listed along with their account.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath(pattern),
+			HelpSynopsis: "Look up the account of an address.",
+			HelpDescription: `
+
+Returns the account holding the key of an address. Accounts can also be used
+by address: addresses/<address>/sign-tx, the other sign paths, send-tx, nonces
+and spending behave like their accounts/<name> counterparts.
+
+`,
+			Fields: identity,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathAddressRead,
+			},
+		},
+	}
+	return framework.PathAppend(
+		paths,
+		signPaths(b, pattern, identity),
+		sendPaths(b, pattern, identity),
+		erc20Paths(b, pattern, identity),
+		noncePaths(b, pattern, identity),
+		spendingPaths(b, pattern, identity),
+	)
+}
+
+func addressIndexPath(address common.Address) string {
+	return QualifiedPath(fmt.Sprintf("addresses/%s", address.Hex()))
+}
+
+// lookupAddress returns the name of the account holding the key of address,
+// or an empty name when no account does
+func lookupAddress(ctx context.Context, s logical.Storage, address common.Address) (string, error) {
+	entry, err := s.Get(ctx, addressIndexPath(address))
+	if err != nil {
+		return Empty, err
+	}
+	if entry == nil {
+		return Empty, nil
+	}
+	var addressEntry AddressEntry
+	if err := entry.DecodeJSON(&addressEntry); err != nil {
+		return Empty, fmt.Errorf("failed to deserialize address %s: %v", address.Hex(), err)
+	}
+	return addressEntry.Account, nil
+}
+
+// addressConflict returns an error response when address is indexed to
+// another account than name
+func addressConflict(ctx context.Context, s logical.Storage, address common.Address, name string) (*logical.Response, error) {
+	current, err := lookupAddress(ctx, s, address)
+	if err != nil {
+		return nil, err
+	}
+	if current != Empty && current != name {
+		return logical.ErrorResponse("address %s is already used by account %s", address.Hex(), current), nil
+	}
+	return nil, nil
+}
+
+// indexAddress records that the account called name holds the key of address.
+// The error response is set when another account already holds it.
+func indexAddress(ctx context.Context, s logical.Storage, address common.Address, name string) (*logical.Response, error) {
+	if resp, err := addressConflict(ctx, s, address, name); resp != nil || err != nil {
+		return resp, err
+	}
+	entry, err := logical.StorageEntryJSON(addressIndexPath(address), &AddressEntry{Account: name})
+	if err != nil {
+		return nil, err
+	}
+	return nil, s.Put(ctx, entry)
+}
+
+// unindexAddress removes address from the index, unless another account has
+// taken it over since
+func unindexAddress(ctx context.Context, s logical.Storage, address common.Address, name string) error {
+	current, err := lookupAddress(ctx, s, address)
+	if err != nil {
+		return err
+	}
+	if current != name {
+		return nil
+	}
+	return s.Delete(ctx, addressIndexPath(address))
+}
+
+// accountAddress returns the address of an account, deriving it for records
+// written before the address was stored
+func accountAddress(accountJSON *AccountJSON) (common.Address, error) {
+	if accountJSON.Address != Empty {
+		return common.HexToAddress(accountJSON.Address), nil
+	}
+	key, address, err := getAccountKey(*accountJSON)
+	if err != nil {
+		return common.Address{}, err
+	}
+	util.ZeroKey(key)
+	return address, nil
+}
+
+// indexAccounts adds the accounts created before addresses were indexed to
+// the index
+func (b *vaultEthereumBackend) indexAccounts(ctx context.Context, s logical.Storage) error {
+	names, err := s.List(ctx, QualifiedPath("accounts/"))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		accountJSON, err := readAccount(ctx, &logical.Request{Storage: s}, name)
+		if err != nil {
+			return err
+		}
+		if accountJSON == nil || accountJSON.Address != Empty {
+			continue
+		}
+		address, err := accountAddress(accountJSON)
+		if err != nil {
+			return fmt.Errorf("failed to derive the address of account %s: %v", name, err)
+		}
+		accountJSON.Address = address.Hex()
+		if err := b.updateAccount(ctx, &logical.Request{Storage: s}, name, accountJSON); err != nil {
+			return err
+		}
+		resp, err := indexAddress(ctx, s, address, name)
+		if err != nil {
+			return err
+		}
+		if resp != nil {
+			b.Logger().Warn("account not indexed by address", "account", name, "error", resp.Error())
+		}
+	}
+	return nil
+}
+
+func (b *vaultEthereumBackend) pathAddressesList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	addresses, err := req.Storage.List(ctx, QualifiedPath("addresses/"))
+	if err != nil {
+		return nil, err
+	}
+	keyInfo := make(map[string]interface{}, len(addresses))
+	for _, address := range addresses {
+		name, err := lookupAddress(ctx, req.Storage, common.HexToAddress(address))
+		if err != nil {
+			return nil, err
+		}
+		keyInfo[address] = map[string]interface{}{
+			"account": name,
+		}
+	}
+	return logical.ListResponseWithInfo(addresses, keyInfo), nil
+}
+
+func (b *vaultEthereumBackend) pathAddressRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	address := common.HexToAddress(data.Get("address").(string))
+	name, err := lookupAddress(ctx, req.Storage, address)
+	if err != nil {
+		return nil, err
+	}
+	if name == Empty {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"address": address.Hex(),
+			"account": name,
+		},
+	}, nil
+}
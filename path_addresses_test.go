@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestAddressIndex(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	resp := mustSucceed(t, request(t, b, s, logical.ListOperation, "addresses/", nil))
+	info := resp.Data["key_info"].(map[string]interface{})
+	if info[testAddress].(map[string]interface{})["account"] != "test" {
+		t.Fatalf("unexpected addresses %v", info)
+	}
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "addresses/"+testAddress, nil))
+	if resp.Data["account"] != "test" {
+		t.Fatalf("unexpected lookup %v", resp.Data)
+	}
+
+	tx := signedTransaction(t, signTxAt(t, b, s, "addresses/"+testAddress, "1", nil))
+	if signer := transactionSigner(t, tx); signer != testAddress {
+		t.Fatalf("expected the transaction to be signed by %s, got %s", testAddress, signer)
+	}
+	mustFail(t, signTxAt(t, b, s, "addresses/"+testRecipient, "1", nil))
+
+	// nonces and spending are those of the account
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "addresses/"+testAddress+"/nonces/1", map[string]interface{}{
+		"next": 7,
+	}))
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/test/nonces/1", nil))
+	if resp.Data["next"] != uint64(7) {
+		t.Fatalf("expected the counter of the account, got %v", resp.Data)
+	}
+	mustSucceed(t, request(t, b, s, logical.ReadOperation, "addresses/"+testAddress+"/spending", nil))
+
+	request(t, b, s, logical.DeleteOperation, "accounts/test", nil)
+	if resp := request(t, b, s, logical.ReadOperation, "addresses/"+testAddress, nil); resp != nil {
+		t.Fatalf("expected the address to be removed with the account, got %v", resp.Data)
+	}
+}
+
+func TestAddressBelongsToOneAccount(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	createTestWallet(t, b, s)
+
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/other", map[string]interface{}{
+		"mnemonic": testMnemonic,
+	}))
+	if resp := request(t, b, s, logical.ReadOperation, "accounts/other", nil); resp != nil {
+		t.Fatalf("expected the conflicting account not to be created, got %v", resp.Data)
+	}
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "wallets/w/accounts", map[string]interface{}{"count": 2}))
+	if resp := request(t, b, s, logical.ReadOperation, "addresses/"+testRecipient, nil); resp != nil {
+		t.Fatalf("expected no address of the wallet to be indexed, got %v", resp.Data)
+	}
+
+	request(t, b, s, logical.DeleteOperation, "accounts/test", nil)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "wallets/w/accounts", map[string]interface{}{"count": 2}))
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "addresses/"+testRecipient, nil))
+	if resp.Data["account"] != "w/1" {
+		t.Fatalf("unexpected lookup %v", resp.Data)
+	}
+	tx := signedTransaction(t, signTxAt(t, b, s, "addresses/"+testRecipient, "1", nil))
+	if signer := transactionSigner(t, tx); signer != testRecipient {
+		t.Fatalf("expected the transaction to be signed by %s, got %s", testRecipient, signer)
+	}
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test", map[string]interface{}{
+		"mnemonic": testMnemonic,
+	}))
+
+	request(t, b, s, logical.DeleteOperation, "wallets/w", nil)
+	if resp := request(t, b, s, logical.ReadOperation, "addresses/"+testRecipient, nil); resp != nil {
+		t.Fatalf("expected the addresses to be removed with the wallet, got %v", resp.Data)
+	}
+	createTestAccount(t, b, s, "other")
+}
+
+func TestSignTxChecksExpectedAddress(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	mustSucceed(t, signTx(t, b, s, "test", "1", map[string]interface{}{"address": testAddress}))
+	mustFail(t, signTx(t, b, s, "test", "1", map[string]interface{}{"address": testRecipient}))
+	mustFail(t, signTx(t, b, s, "test", "1", map[string]interface{}{"address": "0x1234"}))
+}
+
+func TestIndexAccountsOnInitialize(t *testing.T) {
+	b, s := getTestBackend(t)
+	ctx := context.Background()
+	entry, err := logical.StorageEntryJSON("accounts/legacy", &AccountJSON{
+		Type:     AccountTypeHD,
+		Mnemonic: testMnemonic,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.initialize(ctx, &logical.InitializationRequest{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "addresses/"+testAddress, nil))
+	if resp.Data["account"] != "legacy" {
+		t.Fatalf("unexpected lookup %v", resp.Data)
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// TxTypeLegacy is a pre EIP-1559 transaction with a gas price
+	TxTypeLegacy string = "legacy"
+	// TxTypeDynamicFee is an EIP-1559 transaction with a fee cap and a tip
+	TxTypeDynamicFee string = "1559"
+
+	// RuleChainMaxGasPrice caps the gas price on a registered chain
+	RuleChainMaxGasPrice string = "chain_max_gas_price"
+	// RuleChainMaxGasLimit caps the gas limit on a registered chain
+	RuleChainMaxGasLimit string = "chain_max_gas_limit"
+
+	// DefaultDeletionRetention is how long deleted accounts and wallets can be
+	// restored
+	DefaultDeletionRetention time.Duration = 7 * 24 * time.Hour
+)
+
+// ChainConfig describes a network this mount may sign for
+type ChainConfig struct {
+	ChainID     int64  `json:"chain_id"`
+	DisplayName string `json:"display_name"`
+	TxType      string `json:"tx_type"`
+	MaxGasPrice string `json:"max_gas_price,omitempty"`
+	MaxGasLimit uint64 `json:"max_gas_limit,omitempty"`
+	RPCURL      string `json:"rpc_url,omitempty"`
+}
+
+// DeletionConfig governs how deleted accounts and wallets are kept
+type DeletionConfig struct {
+	Retention time.Duration `json:"retention"`
+}
+
+func configPaths(b *vaultEthereumBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("config/chains/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathChainsList,
+			},
+			HelpSynopsis: "List the chains registered on this mount",
+			HelpDescription: `
+			All the registered chains will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("config/chains/" + framework.GenericNameRegex("chain")),
+			HelpSynopsis: "Register a chain this mount may sign for.",
+			HelpDescription: `
+
+Registers a chain by name. Sign requests can then use chain=<name> instead of
+chain_id. When at least one chain is registered, requests for chain IDs that
+are not registered are rejected.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"chain": {Type: framework.TypeString},
+				"chain_id": {
+					Type:        framework.TypeInt64,
+					Description: "The chain ID.",
+				},
+				"display_name": {
+					Type:        framework.TypeString,
+					Description: "A human readable name of the chain.",
+				},
+				"tx_type": {
+					Type:          framework.TypeString,
+					Description:   "The default transaction type of the chain: legacy or 1559.",
+					Default:       TxTypeDynamicFee,
+					AllowedValues: []interface{}{TxTypeLegacy, TxTypeDynamicFee},
+				},
+				"max_gas_price": {
+					Type:        framework.TypeString,
+					Description: "The maximum gas price (or max fee per gas for EIP-1559) in wei.",
+				},
+				"max_gas_limit": {
+					Type:        framework.TypeInt,
+					Description: "The maximum gas limit of a transaction.",
+				},
+				"rpc_url": {
+					Type:        framework.TypeString,
+					Description: "The JSON-RPC endpoint of the chain.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathChainRead,
+				logical.CreateOperation: b.pathChainWrite,
+				logical.UpdateOperation: b.pathChainWrite,
+				logical.DeleteOperation: b.pathChainDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("config/deletion"),
+			HelpSynopsis: "Configure how long deleted accounts are kept.",
+			HelpDescription: `
+
+Deleted accounts and wallets are moved to deleted-accounts/ and
+deleted-wallets/ and can be restored until their retention period ends, when
+they are purged for good.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"retention": {
+					Type:        framework.TypeDurationSecond,
+					Description: "How long a deleted account can be restored.",
+					Default:     int(DefaultDeletionRetention.Seconds()),
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathDeletionConfigRead,
+				logical.CreateOperation: b.pathDeletionConfigWrite,
+				logical.UpdateOperation: b.pathDeletionConfigWrite,
+			},
+		},
+	}
+}
+
+func chainPath(name string) string {
+	return QualifiedPath(fmt.Sprintf("config/chains/%s", name))
+}
+
+func readChain(ctx context.Context, s logical.Storage, name string) (*ChainConfig, error) {
+	entry, err := s.Get(ctx, chainPath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var chain ChainConfig
+	if err := entry.DecodeJSON(&chain); err != nil {
+		return nil, fmt.Errorf("failed to deserialize chain %s: %v", name, err)
+	}
+	return &chain, nil
+}
+
+// readChainByID finds the name and the configuration of the registered chain
+// with the given chain ID. It also reports whether any chain is registered.
+func readChainByID(ctx context.Context, s logical.Storage, chainID int64) (string, *ChainConfig, bool, error) {
+	names, err := s.List(ctx, QualifiedPath("config/chains/"))
+	if err != nil {
+		return Empty, nil, false, err
+	}
+	for _, name := range names {
+		chain, err := readChain(ctx, s, name)
+		if err != nil {
+			return Empty, nil, false, err
+		}
+		if chain != nil && chain.ChainID == chainID {
+			return name, chain, true, nil
+		}
+	}
+	return Empty, nil, len(names) > 0, nil
+}
+
+// resolveChain determines the chain a sign request targets from either its
+// chain name or its chain ID. The error response is set when the chain is
+// unknown or not registered.
+func resolveChain(ctx context.Context, s logical.Storage, data *framework.FieldData) (*big.Int, *ChainConfig, *logical.Response, error) {
+	rawChainID, chainIDSet := data.GetOk("chain_id")
+
+	if name, ok := data.GetOk("chain"); ok && name.(string) != Empty {
+		chain, err := readChain(ctx, s, name.(string))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if chain == nil {
+			return nil, nil, logical.ErrorResponse("unknown chain %s", name), nil
+		}
+		if chainIDSet && rawChainID.(int64) != chain.ChainID {
+			return nil, nil, logical.ErrorResponse("chain_id %d does not match chain %s", rawChainID, name), nil
+		}
+		return big.NewInt(chain.ChainID), chain, nil, nil
+	}
+
+	if !chainIDSet {
+		return nil, nil, logical.ErrorResponse("Chain ID not specified"), nil
+	}
+	chainID := rawChainID.(int64)
+	if chainID == 0 {
+		return nil, nil, logical.ErrorResponse("invalid chain id"), nil
+	}
+
+	_, chain, registry, err := readChainByID(ctx, s, chainID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if chain == nil && registry {
+		return nil, nil, logical.ErrorResponse("chain ID %d is not registered", chainID), nil
+	}
+	return big.NewInt(chainID), chain, nil, nil
+}
+
+// Evaluate checks a transaction against the gas caps of the chain
+func (chain *ChainConfig) Evaluate(gasFeeCap *big.Int, gas uint64) *PolicyViolation {
+	if chain == nil {
+		return nil
+	}
+	if chain.MaxGasPrice != Empty {
+		maxGasPrice, _ := new(big.Int).SetString(chain.MaxGasPrice, 10)
+		if gasFeeCap.Cmp(maxGasPrice) > 0 {
+			return &PolicyViolation{RuleChainMaxGasPrice, fmt.Sprintf("gas price %s exceeds %s on %s", gasFeeCap, maxGasPrice, chain.DisplayName)}
+		}
+	}
+	if chain.MaxGasLimit > 0 && gas > chain.MaxGasLimit {
+		return &PolicyViolation{RuleChainMaxGasLimit, fmt.Sprintf("gas limit %d exceeds %d on %s", gas, chain.MaxGasLimit, chain.DisplayName)}
+	}
+	return nil
+}
+
+func (b *vaultEthereumBackend) pathChainsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, QualifiedPath("config/chains/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *vaultEthereumBackend) pathChainRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	chain, err := readChain(ctx, req.Storage, data.Get("chain").(string))
+	if err != nil {
+		return nil, err
+	}
+	if chain == nil {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"chain_id":      chain.ChainID,
+			"display_name":  chain.DisplayName,
+			"tx_type":       chain.TxType,
+			"max_gas_price": chain.MaxGasPrice,
+			"max_gas_limit": chain.MaxGasLimit,
+			"rpc_url":       chain.RPCURL,
+		},
+	}, nil
+}
+
+func (b *vaultEthereumBackend) pathChainWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("chain").(string)
+	chain, err := readChain(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if chain == nil {
+		chain = &ChainConfig{DisplayName: name, TxType: data.Get("tx_type").(string)}
+	}
+
+	if chainID, ok := data.GetOk("chain_id"); ok {
+		chain.ChainID = chainID.(int64)
+	}
+	if chain.ChainID <= 0 {
+		return logical.ErrorResponse("invalid chain id"), nil
+	}
+	registered, _, _, err := readChainByID(ctx, req.Storage, chain.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	if registered != Empty && registered != name {
+		return logical.ErrorResponse("chain ID %d is already registered as %s", chain.ChainID, registered), nil
+	}
+	if displayName, ok := data.GetOk("display_name"); ok {
+		chain.DisplayName = displayName.(string)
+	}
+	if txType, ok := data.GetOk("tx_type"); ok {
+		if txType.(string) != TxTypeLegacy && txType.(string) != TxTypeDynamicFee {
+			return logical.ErrorResponse("invalid tx_type %s", txType), nil
+		}
+		chain.TxType = txType.(string)
+	}
+	if maxGasPrice, ok := data.GetOk("max_gas_price"); ok {
+		if !validAmount(maxGasPrice.(string)) {
+			return logical.ErrorResponse("invalid max_gas_price"), nil
+		}
+		chain.MaxGasPrice = maxGasPrice.(string)
+	}
+	if maxGasLimit, ok := data.GetOk("max_gas_limit"); ok {
+		if maxGasLimit.(int) < 0 {
+			return logical.ErrorResponse("invalid max_gas_limit"), nil
+		}
+		chain.MaxGasLimit = uint64(maxGasLimit.(int))
+	}
+	if rpcURL, ok := data.GetOk("rpc_url"); ok {
+		if rpcURL.(string) != Empty {
+			if _, err := url.ParseRequestURI(rpcURL.(string)); err != nil {
+				return logical.ErrorResponse("invalid rpc_url: %v", err), nil
+			}
+		}
+		chain.RPCURL = rpcURL.(string)
+	}
+
+	entry, err := logical.StorageEntryJSON(chainPath(name), chain)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	return b.pathChainRead(ctx, req, data)
+}
+
+func (b *vaultEthereumBackend) pathChainDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return nil, req.Storage.Delete(ctx, chainPath(data.Get("chain").(string)))
+}
+
+// readDeletionConfig returns the deletion configuration, or the defaults when
+// none was written
+func readDeletionConfig(ctx context.Context, s logical.Storage) (*DeletionConfig, error) {
+	entry, err := s.Get(ctx, QualifiedPath("config/deletion"))
+	if err != nil {
+		return nil, err
+	}
+	config := DeletionConfig{Retention: DefaultDeletionRetention}
+	if entry == nil {
+		return &config, nil
+	}
+	if err := entry.DecodeJSON(&config); err != nil {
+		return nil, fmt.Errorf("failed to deserialize the deletion configuration: %v", err)
+	}
+	return &config, nil
+}
+
+func (b *vaultEthereumBackend) pathDeletionConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := readDeletionConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"retention": int64(config.Retention.Seconds()),
+		},
+	}, nil
+}
+
+func (b *vaultEthereumBackend) pathDeletionConfigWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	retention := time.Duration(data.Get("retention").(int)) * time.Second
+	if retention <= 0 {
+		return logical.ErrorResponse("retention must be positive"), nil
+	}
+	entry, err := logical.StorageEntryJSON(QualifiedPath("config/deletion"), &DeletionConfig{Retention: retention})
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	return b.pathDeletionConfigRead(ctx, req, data)
+}
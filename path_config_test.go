@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestChainRegistry(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	mustSucceed(t, signTx(t, b, s, "test", "1", map[string]interface{}{"chain_id": 5}))
+
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "config/chains/mainnet", map[string]interface{}{
+		"chain_id":      1,
+		"display_name":  "Ethereum",
+		"max_gas_price": "2000000000",
+		"max_gas_limit": 21000,
+		"rpc_url":       "https://rpc.example.com",
+	}))
+	if resp.Data["tx_type"] != TxTypeDynamicFee || resp.Data["display_name"] != "Ethereum" {
+		t.Fatalf("unexpected chain %v", resp.Data)
+	}
+	resp = mustSucceed(t, request(t, b, s, logical.ListOperation, "config/chains/", nil))
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"mainnet"}) {
+		t.Fatalf("expected mainnet to be listed, got %v", resp.Data["keys"])
+	}
+
+	signTxOnMainnet := map[string]interface{}{"chain_id": nil, "chain": "mainnet"}
+	mustSucceed(t, signTx(t, b, s, "test", "1", signTxOnMainnet))
+	mustFail(t, signTx(t, b, s, "test", "1", map[string]interface{}{"chain_id": 5}))
+	mustFail(t, signTx(t, b, s, "test", "1", map[string]interface{}{"chain_id": 5, "chain": "mainnet"}))
+	mustFail(t, signTx(t, b, s, "test", "1", map[string]interface{}{"chain": "unknown"}))
+
+	for rule, data := range map[string]map[string]interface{}{
+		RuleChainMaxGasPrice: {"gas_price": "2000000001"},
+		RuleChainMaxGasLimit: {"gas_limit": "21001"},
+	} {
+		if got := violatedRule(t, signTx(t, b, s, "test", "1", data)); got != rule {
+			t.Fatalf("expected rule %s to be violated, got %s", rule, got)
+		}
+	}
+
+	request(t, b, s, logical.DeleteOperation, "config/chains/mainnet", nil)
+	mustSucceed(t, signTx(t, b, s, "test", "1", map[string]interface{}{"chain_id": 5}))
+}
+
+func TestChainRegistryRejectsInvalidChains(t *testing.T) {
+	b, s := getTestBackend(t)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "config/chains/mainnet", map[string]interface{}{
+		"chain_id": 1,
+	}))
+
+	for name, data := range map[string]map[string]interface{}{
+		"mainnet2": {"chain_id": 1},
+		"nochain":  {},
+		"badprice": {"chain_id": 2, "max_gas_price": "cheap"},
+		"badurl":   {"chain_id": 3, "rpc_url": "not a url"},
+		"badtype":  {"chain_id": 4, "tx_type": "2930"},
+	} {
+		mustFail(t, request(t, b, s, logical.UpdateOperation, "config/chains/"+name, data))
+	}
+}
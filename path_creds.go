@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/bliiitz/vault-ethereum/util"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pborman/uuid"
+)
+
+// SecretTypeEphemeralAccount is the secret of an account issued by creds/<role>
+const SecretTypeEphemeralAccount string = "ephemeral_account"
+
+// sweepGasLimit is the gas limit of the transfer sweeping an account
+const sweepGasLimit uint64 = 21000
+
+func ephemeralAccountSecret(b *vaultEthereumBackend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretTypeEphemeralAccount,
+		Fields: map[string]*framework.FieldSchema{
+			"account": {
+				Type:        framework.TypeString,
+				Description: "The name of the account under accounts/.",
+			},
+			"address": {
+				Type:        framework.TypeString,
+				Description: "The address of the account.",
+			},
+		},
+		Renew:  b.ephemeralAccountRenew,
+		Revoke: b.ephemeralAccountRevoke,
+	}
+}
+
+func credsPaths(b *vaultEthereumBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("creds/" + framework.GenericNameRegex("role")),
+			HelpSynopsis: "Issue an ephemeral account.",
+			HelpDescription: `
+
+Generates a throwaway account backed by a Vault lease. The account signs
+through the usual accounts/<account>/... paths until the lease ends, when it
+is swept to the sweep_to address of the role, if any, and deleted for good.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"role": {Type: framework.TypeString},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathCredsRead,
+			},
+		},
+	}
+}
+
+func (b *vaultEthereumBackend) pathCredsRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+	role, err := readRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse("role %s does not exist", roleName), nil
+	}
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	defer util.ZeroKey(key)
+
+	name := fmt.Sprintf("%s-%s", roleName, uuid.New())
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	accountJSON := &AccountJSON{
+		Type:        AccountTypeKey,
+		Address:     address.Hex(),
+		PrivateKey:  hex.EncodeToString(crypto.FromECDSA(key)),
+		Description: fmt.Sprintf("Ephemeral account issued by role %s", roleName),
+		CreatedAt:   time.Now().UTC(),
+	}
+	if resp, err := indexAddress(ctx, req.Storage, address, name); resp != nil || err != nil {
+		return resp, err
+	}
+	if err := b.updateAccount(ctx, req, name, accountJSON); err != nil {
+		return nil, err
+	}
+
+	resp := b.Secret(SecretTypeEphemeralAccount).Response(map[string]interface{}{
+		"account": name,
+		"address": address.Hex(),
+	}, map[string]interface{}{
+		"account":  name,
+		"role":     roleName,
+		"sweep_to": role.SweepTo,
+		"chain":    role.Chain,
+	})
+	resp.Secret.TTL = role.TTL
+	resp.Secret.MaxTTL = role.MaxTTL
+	return resp, nil
+}
+
+func (b *vaultEthereumBackend) ephemeralAccountRenew(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName, _ := req.Secret.InternalData["role"].(string)
+	role, err := readRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse("role %s does not exist", roleName), nil
+	}
+	return framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())(ctx, req, data)
+}
+
+// ephemeralAccountRevoke sweeps the balance of an account, if its role asked
+// for it, then deletes the account for good: unlike a deleted account, a
+// revoked one cannot be restored. The account is kept when the sweep fails so
+// that Vault retries the revocation.
+func (b *vaultEthereumBackend) ephemeralAccountRevoke(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name, ok := req.Secret.InternalData["account"].(string)
+	if !ok || name == Empty {
+		return nil, fmt.Errorf("secret is missing the account name")
+	}
+	accountJSON, err := readAccount(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	if accountJSON == nil {
+		return nil, nil
+	}
+
+	sweepTo, _ := req.Secret.InternalData["sweep_to"].(string)
+	if sweepTo != Empty {
+		chainName, _ := req.Secret.InternalData["chain"].(string)
+		if err := b.sweepAccount(ctx, req.Storage, accountJSON, chainName, common.HexToAddress(sweepTo)); err != nil {
+			return nil, fmt.Errorf("failed to sweep account %s: %v", name, err)
+		}
+	}
+	address, err := accountAddress(accountJSON)
+	if err != nil {
+		return nil, err
+	}
+	if err := removeAccount(ctx, req.Storage, name, address); err != nil {
+		return nil, err
+	}
+	return nil, b.purgeAccount(ctx, req.Storage, name)
+}
+
+// sweepAccount sends the whole balance of an account, less the fee, to a
+// recipient. Balances that do not cover the fee are left behind.
+func (b *vaultEthereumBackend) sweepAccount(ctx context.Context, s logical.Storage, accountJSON *AccountJSON, chainName string, to common.Address) error {
+	chain, err := readChain(ctx, s, chainName)
+	if err != nil {
+		return err
+	}
+	if chain == nil || chain.RPCURL == Empty {
+		return fmt.Errorf("chain %s is not registered with an rpc_url", chainName)
+	}
+
+	key, from, err := getAccountKey(*accountJSON)
+	if err != nil {
+		return err
+	}
+	defer util.ZeroKey(key)
+
+	client, err := b.newClient(ctx, chain.RPCURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", chain.DisplayName, err)
+	}
+	defer closeClient(client)
+
+	fees, err := suggestSweepFees(ctx, client, big.NewInt(chain.ChainID), chain.TxType)
+	if err != nil {
+		return err
+	}
+	nonce, err := client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return err
+	}
+	signedTx, err := sweepTransaction(ctx, client, key, to, nonce, fees, new(big.Int))
+	if err != nil || signedTx == nil {
+		return err
+	}
+	b.Logger().Info("sweeping ephemeral account", "from", from.Hex(), "to", to.Hex(), "value", signedTx.Value(), "hash", signedTx.Hash().Hex())
+	return client.SendTransaction(ctx, signedTx)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// revoke revokes the lease of an ephemeral account
+func revoke(t *testing.T, b *vaultEthereumBackend, s logical.Storage, secret *logical.Secret) *logical.Response {
+	t.Helper()
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   s,
+		Secret:    secret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestRoles(t *testing.T) {
+	b, s := getTestBackend(t)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "config/chains/sim", map[string]interface{}{
+		"chain_id": simulatedChainID,
+		"rpc_url":  "http://127.0.0.1:8545",
+	}))
+
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "roles/ci", map[string]interface{}{
+		"ttl":      "1h",
+		"max_ttl":  "24h",
+		"sweep_to": "0x70997970c51812dc3a010c7d01b50e0d17dc79c8",
+		"chain":    "sim",
+	}))
+	if resp.Data["ttl"] != int64(3600) || resp.Data["sweep_to"] != testRecipient {
+		t.Fatalf("unexpected role %v", resp.Data)
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"ttl": "2d"},
+		{"sweep_to": "nope"},
+		{"chain": "missing"},
+		{"chain": ""},
+	} {
+		mustFail(t, request(t, b, s, logical.UpdateOperation, "roles/ci", data))
+	}
+
+	request(t, b, s, logical.DeleteOperation, "roles/ci", nil)
+	mustFail(t, request(t, b, s, logical.ReadOperation, "creds/ci", nil))
+}
+
+func TestCredsIssueEphemeralAccount(t *testing.T) {
+	b, s := getTestBackend(t)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "roles/ci", map[string]interface{}{
+		"ttl": "1h",
+	}))
+
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "creds/ci", nil))
+	if resp.Secret == nil || resp.Secret.TTL.Hours() != 1 {
+		t.Fatalf("expected a lease of 1h, got %v", resp.Secret)
+	}
+	name := resp.Data["account"].(string)
+	account := mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/"+name, nil))
+	if account.Data["address"] != resp.Data["address"] {
+		t.Fatalf("expected account %s to hold %v, got %v", name, resp.Data["address"], account.Data["address"])
+	}
+	mustSucceed(t, signTx(t, b, s, name, "1", nil))
+
+	revoke(t, b, s, resp.Secret)
+	if entry, err := s.Get(context.Background(), "accounts/"+name); err != nil || entry != nil {
+		t.Fatalf("expected account %s to be deleted, got %v, %v", name, entry, err)
+	}
+}
+
+func TestCredsSweepOnRevoke(t *testing.T) {
+	b, s := getTestBackend(t)
+	sim := newSimulatedChain(t, b, s, "test")
+	gasPrice := big.NewInt(2000000000)
+	b.newClient = func(ctx context.Context, rpcURL string) (ethClient, error) {
+		return pricedClient{simClient{sim}, gasPrice}, nil
+	}
+	// the sweep uses the tx_type of the chain; legacy ones leave nothing behind
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "config/chains/sim", map[string]interface{}{
+		"tx_type": TxTypeLegacy,
+	}))
+	sweepTo := common.HexToAddress(testRecipient)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "roles/ci", map[string]interface{}{
+		"sweep_to": sweepTo.Hex(),
+		"chain":    "sim",
+	}))
+
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "creds/ci", nil))
+	ephemeral := resp.Data["address"].(string)
+	funding := big.NewInt(1e18)
+	sentTransaction(t, sendTx(t, b, s, map[string]interface{}{"to": ephemeral, "value": funding.String()}))
+	sim.Commit()
+
+	revoke(t, b, s, resp.Secret)
+	sim.Commit()
+
+	ctx := context.Background()
+	swept, err := sim.BalanceAt(ctx, sweepTo, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fee := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(sweepGasLimit))
+	if expected := new(big.Int).Sub(funding, fee); swept.Cmp(expected) != 0 {
+		t.Fatalf("expected %s to be swept, got %s", expected, swept)
+	}
+	if left, _ := sim.BalanceAt(ctx, common.HexToAddress(ephemeral), nil); left.Sign() != 0 {
+		t.Fatalf("expected an empty account, got %s", left)
+	}
+}
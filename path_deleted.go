@@ -0,0 +1,561 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// DeletedAccount is an account kept after its deletion so that it can be
+// restored until PurgeAt
+type DeletedAccount struct {
+	Account   AccountJSON `json:"account"`
+	DeletedBy string      `json:"deleted_by,omitempty"`
+	DeletedAt time.Time   `json:"deleted_at"`
+	PurgeAt   time.Time   `json:"purge_at"`
+}
+
+func deletedAccountPaths(b *vaultEthereumBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("deleted-accounts/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathDeletedAccountsList,
+			},
+			HelpSynopsis: "List the deleted accounts that can be restored",
+			HelpDescription: `
+			All the deleted accounts will be listed along with the time they are purged.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("deleted-accounts/" + framework.GenericNameRegex("name")),
+			HelpSynopsis: "Read or purge a deleted account.",
+			HelpDescription: `
+
+Reading describes a deleted account. Deleting purges it for good, along with
+its previous keys, its nonce counters and its spending history, without
+waiting for the end of its retention period.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathDeletedAccountRead,
+				logical.DeleteOperation: b.pathDeletedAccountPurge,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("deleted-accounts/" + framework.GenericNameRegex("name") + "/restore"),
+			HelpSynopsis: "Restore a deleted account.",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathDeletedAccountRestore,
+				logical.UpdateOperation: b.pathDeletedAccountRestore,
+			},
+		},
+	}
+}
+
+func deletedAccountPath(name string) string {
+	return QualifiedPath(fmt.Sprintf("deleted-accounts/%s", name))
+}
+
+func readDeletedAccount(ctx context.Context, s logical.Storage, name string) (*DeletedAccount, error) {
+	entry, err := s.Get(ctx, deletedAccountPath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var deleted DeletedAccount
+	if err := entry.DecodeJSON(&deleted); err != nil {
+		return nil, fmt.Errorf("failed to deserialize deleted account %s: %v", name, err)
+	}
+	return &deleted, nil
+}
+
+func (deleted *DeletedAccount) data() map[string]interface{} {
+	return map[string]interface{}{
+		"address":    deleted.Account.Address,
+		"deleted_by": deleted.DeletedBy,
+		"deleted_at": deleted.DeletedAt.Format(time.RFC3339),
+		"purge_at":   deleted.PurgeAt.Format(time.RFC3339),
+	}
+}
+
+// deleteAccount moves an account to deleted-accounts/ until the retention
+// period ends. Its address is unindexed right away, while its nonce counters
+// and its spending history are kept for a restore.
+func (b *vaultEthereumBackend) deleteAccount(ctx context.Context, s logical.Storage, name string, actor string) error {
+	return b.archiveAccount(ctx, s, name, name, actor)
+}
+
+// archiveAccount moves the account called name to deleted-accounts/<deletedName>.
+// When the names differ, its previous keys, nonce counters, spending history
+// and last use move along with it, so that it is restored under deletedName
+// and name is free for another account.
+func (b *vaultEthereumBackend) archiveAccount(ctx context.Context, s logical.Storage, name string, deletedName string, actor string) error {
+	accountJSON, err := readAccount(ctx, &logical.Request{Storage: s}, name)
+	if err != nil {
+		return err
+	}
+	if accountJSON == nil {
+		return nil
+	}
+	address, err := accountAddress(accountJSON)
+	if err != nil {
+		return err
+	}
+	accountJSON.Address = address.Hex()
+
+	config, err := readDeletionConfig(ctx, s)
+	if err != nil {
+		return err
+	}
+	if deletedName != name {
+		if err := b.moveAccountState(ctx, s, name, deletedName); err != nil {
+			return err
+		}
+	}
+	now := time.Now().UTC()
+	entry, err := logical.StorageEntryJSON(deletedAccountPath(deletedName), &DeletedAccount{
+		Account:   *accountJSON,
+		DeletedBy: actor,
+		DeletedAt: now,
+		PurgeAt:   now.Add(config.Retention),
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		return err
+	}
+	return removeAccount(ctx, s, name, address)
+}
+
+// removeAccount drops the record of an account and its address from the index
+func removeAccount(ctx context.Context, s logical.Storage, name string, address common.Address) error {
+	if err := unindexAddress(ctx, s, address, name); err != nil {
+		return err
+	}
+	return s.Delete(ctx, QualifiedPath(fmt.Sprintf("accounts/%s", name)))
+}
+
+// moveAccountState moves the previous keys, nonce counters, spending history
+// and last use of the account called name to the account called to
+func (b *vaultEthereumBackend) moveAccountState(ctx context.Context, s logical.Storage, name string, to string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, prefix := range []string{"key-versions/", "nonces/"} {
+		fromPrefix := QualifiedPath(prefix + name + "/")
+		toPrefix := QualifiedPath(prefix + to + "/")
+		keys, err := s.List(ctx, fromPrefix)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if strings.HasSuffix(key, "/") {
+				continue
+			}
+			if err := moveEntry(ctx, s, fromPrefix+key, toPrefix+key); err != nil {
+				return err
+			}
+		}
+	}
+	if err := moveEntry(ctx, s, lastUsedPath(name), lastUsedPath(to)); err != nil {
+		return err
+	}
+	return moveEntry(ctx, s, spendingPath(name), spendingPath(to))
+}
+
+// moveEntry moves the storage entry at from, if any, to to
+func moveEntry(ctx context.Context, s logical.Storage, from string, to string) error {
+	entry, err := s.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+	entry.Key = to
+	if err := s.Put(ctx, entry); err != nil {
+		return err
+	}
+	return s.Delete(ctx, from)
+}
+
+// purgeAccount removes a deleted account for good, along with its previous
+// keys, its nonce counters and its spending history
+func (b *vaultEthereumBackend) purgeAccount(ctx context.Context, s logical.Storage, name string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := deleteKeyVersions(ctx, s, name); err != nil {
+		return err
+	}
+	if err := deleteNonceCounters(ctx, s, name); err != nil {
+		return err
+	}
+	if err := s.Delete(ctx, lastUsedPath(name)); err != nil {
+		return err
+	}
+	if err := s.Delete(ctx, spendingPath(name)); err != nil {
+		return err
+	}
+	return s.Delete(ctx, deletedAccountPath(name))
+}
+
+// purgeDeletedAccounts purges the deleted accounts whose retention period
+// ended
+func (b *vaultEthereumBackend) purgeDeletedAccounts(ctx context.Context, s logical.Storage) error {
+	names, err := s.List(ctx, QualifiedPath("deleted-accounts/"))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, name := range names {
+		deleted, err := readDeletedAccount(ctx, s, name)
+		if err != nil {
+			return err
+		}
+		if deleted == nil || now.Before(deleted.PurgeAt) {
+			continue
+		}
+		b.Logger().Info("purging deleted account", "account", name, "address", deleted.Account.Address)
+		if err := b.purgeAccount(ctx, s, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *vaultEthereumBackend) pathDeletedAccountsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	names, err := req.Storage.List(ctx, QualifiedPath("deleted-accounts/"))
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	keyInfo := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		deleted, err := readDeletedAccount(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if deleted == nil {
+			continue
+		}
+		keys = append(keys, name)
+		keyInfo[name] = deleted.data()
+	}
+	return logical.ListResponseWithInfo(keys, keyInfo), nil
+}
+
+func (b *vaultEthereumBackend) pathDeletedAccountRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	deleted, err := readDeletedAccount(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if deleted == nil {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: deleted.data(),
+	}, nil
+}
+
+func (b *vaultEthereumBackend) pathDeletedAccountPurge(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	deleted, err := readDeletedAccount(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if deleted == nil {
+		return nil, nil
+	}
+	b.Logger().Warn("purging deleted account", "account", name, "address", deleted.Account.Address, "actor", req.DisplayName)
+	return nil, b.purgeAccount(ctx, req.Storage, name)
+}
+
+func (b *vaultEthereumBackend) pathDeletedAccountRestore(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	deleted, err := readDeletedAccount(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if deleted == nil {
+		return logical.ErrorResponse("deleted account %s does not exist", name), nil
+	}
+	existing, err := readAccount(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return logical.ErrorResponse("account %s already exists", name), nil
+	}
+
+	accountJSON := deleted.Account
+	address, err := accountAddress(&accountJSON)
+	if err != nil {
+		return nil, err
+	}
+	if resp, err := indexAddress(ctx, req.Storage, address, name); resp != nil || err != nil {
+		return resp, err
+	}
+	if err := b.updateAccount(ctx, req, name, &accountJSON); err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, deletedAccountPath(name)); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"address": address.Hex(),
+		},
+	}, nil
+}
+
+// DeletedWallet is a wallet kept after its deletion so that it can be
+// restored until PurgeAt
+type DeletedWallet struct {
+	Wallet    WalletJSON `json:"wallet"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
+	DeletedAt time.Time  `json:"deleted_at"`
+	PurgeAt   time.Time  `json:"purge_at"`
+}
+
+func deletedWalletPaths(b *vaultEthereumBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("deleted-wallets/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathDeletedWalletsList,
+			},
+			HelpSynopsis: "List the deleted wallets that can be restored",
+			HelpDescription: `
+			All the deleted wallets will be listed along with the time they are purged.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("deleted-wallets/" + framework.GenericNameRegex("wallet")),
+			HelpSynopsis: "Read or purge a deleted wallet.",
+			HelpDescription: `
+
+Reading describes a deleted wallet. Deleting purges it for good, along with
+the recorded addresses, the nonce counters and the spending history of its
+accounts, without waiting for the end of its retention period.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"wallet": {Type: framework.TypeString},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathDeletedWalletRead,
+				logical.DeleteOperation: b.pathDeletedWalletPurge,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("deleted-wallets/" + framework.GenericNameRegex("wallet") + "/restore"),
+			HelpSynopsis: "Restore a deleted wallet.",
+			Fields: map[string]*framework.FieldSchema{
+				"wallet": {Type: framework.TypeString},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathDeletedWalletRestore,
+				logical.UpdateOperation: b.pathDeletedWalletRestore,
+			},
+		},
+	}
+}
+
+func deletedWalletPath(name string) string {
+	return QualifiedPath(fmt.Sprintf("deleted-wallets/%s", name))
+}
+
+func readDeletedWallet(ctx context.Context, s logical.Storage, name string) (*DeletedWallet, error) {
+	entry, err := s.Get(ctx, deletedWalletPath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var deleted DeletedWallet
+	if err := entry.DecodeJSON(&deleted); err != nil {
+		return nil, fmt.Errorf("failed to deserialize deleted wallet %s: %v", name, err)
+	}
+	return &deleted, nil
+}
+
+func (deleted *DeletedWallet) data() map[string]interface{} {
+	return map[string]interface{}{
+		"base_path":  deleted.Wallet.BasePath,
+		"deleted_by": deleted.DeletedBy,
+		"deleted_at": deleted.DeletedAt.Format(time.RFC3339),
+		"purge_at":   deleted.PurgeAt.Format(time.RFC3339),
+	}
+}
+
+// deleteWallet moves a wallet to deleted-wallets/ until the retention period
+// ends. The addresses of its accounts are unindexed right away, while their
+// recorded addresses, nonce counters and spending history are kept for a
+// restore.
+func (b *vaultEthereumBackend) deleteWallet(ctx context.Context, s logical.Storage, name string, actor string) error {
+	wallet, err := readWallet(ctx, s, name)
+	if err != nil || wallet == nil {
+		return err
+	}
+	config, err := readDeletionConfig(ctx, s)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	entry, err := logical.StorageEntryJSON(deletedWalletPath(name), &DeletedWallet{
+		Wallet:    *wallet,
+		DeletedBy: actor,
+		DeletedAt: now,
+		PurgeAt:   now.Add(config.Retention),
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		return err
+	}
+	if err := unindexWallet(ctx, s, name); err != nil {
+		return err
+	}
+	return s.Delete(ctx, walletPath(name))
+}
+
+// purgeWallet removes a deleted wallet for good, along with the state of its
+// accounts
+func (b *vaultEthereumBackend) purgeWallet(ctx context.Context, s logical.Storage, name string) error {
+	if err := b.deleteWalletState(ctx, s, name); err != nil {
+		return err
+	}
+	return s.Delete(ctx, deletedWalletPath(name))
+}
+
+// purgeDeletedWallets purges the deleted wallets whose retention period ended
+func (b *vaultEthereumBackend) purgeDeletedWallets(ctx context.Context, s logical.Storage) error {
+	names, err := s.List(ctx, QualifiedPath("deleted-wallets/"))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, name := range names {
+		deleted, err := readDeletedWallet(ctx, s, name)
+		if err != nil {
+			return err
+		}
+		if deleted == nil || now.Before(deleted.PurgeAt) {
+			continue
+		}
+		b.Logger().Info("purging deleted wallet", "wallet", name)
+		if err := b.purgeWallet(ctx, s, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *vaultEthereumBackend) pathDeletedWalletsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	names, err := req.Storage.List(ctx, QualifiedPath("deleted-wallets/"))
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	keyInfo := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		deleted, err := readDeletedWallet(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if deleted == nil {
+			continue
+		}
+		keys = append(keys, name)
+		keyInfo[name] = deleted.data()
+	}
+	return logical.ListResponseWithInfo(keys, keyInfo), nil
+}
+
+func (b *vaultEthereumBackend) pathDeletedWalletRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	deleted, err := readDeletedWallet(ctx, req.Storage, data.Get("wallet").(string))
+	if err != nil {
+		return nil, err
+	}
+	if deleted == nil {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: deleted.data(),
+	}, nil
+}
+
+func (b *vaultEthereumBackend) pathDeletedWalletPurge(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("wallet").(string)
+	deleted, err := readDeletedWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if deleted == nil {
+		return nil, nil
+	}
+	b.Logger().Warn("purging deleted wallet", "wallet", name, "actor", req.DisplayName)
+	return nil, b.purgeWallet(ctx, req.Storage, name)
+}
+
+func (b *vaultEthereumBackend) pathDeletedWalletRestore(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("wallet").(string)
+	deleted, err := readDeletedWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if deleted == nil {
+		return logical.ErrorResponse("deleted wallet %s does not exist", name), nil
+	}
+	existing, err := readWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return logical.ErrorResponse("wallet %s already exists", name), nil
+	}
+
+	indexes, err := recordedAddresses(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	for address, index := range indexes {
+		if resp, err := addressConflict(ctx, req.Storage, address, walletAccountName(name, index)); resp != nil || err != nil {
+			return resp, err
+		}
+	}
+	for address, index := range indexes {
+		if _, err := indexAddress(ctx, req.Storage, address, walletAccountName(name, index)); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeWallet(ctx, req.Storage, name, &deleted.Wallet); err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, deletedWalletPath(name)); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"base_path": deleted.Wallet.BasePath,
+		},
+	}, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// expirePurge moves the purge time of a deleted account or wallet to the past
+// and runs the periodic function
+func expirePurge(t *testing.T, b *vaultEthereumBackend, s logical.Storage, path string, deleted interface{}) {
+	t.Helper()
+	ctx := context.Background()
+	entry, err := s.Get(ctx, path)
+	if err != nil || entry == nil {
+		t.Fatalf("expected %s to exist, got %v, %v", path, entry, err)
+	}
+	if err := entry.DecodeJSON(deleted); err != nil {
+		t.Fatal(err)
+	}
+	switch deleted := deleted.(type) {
+	case *DeletedAccount:
+		deleted.PurgeAt = time.Now().Add(-time.Second)
+	case *DeletedWallet:
+		deleted.PurgeAt = time.Now().Add(-time.Second)
+	}
+	if entry, err = logical.StorageEntryJSON(path, deleted); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.periodicFunc(ctx, &logical.Request{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAccountSoftDelete(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/nonces/1", map[string]interface{}{
+		"next": 3,
+	}))
+
+	request(t, b, s, logical.DeleteOperation, "accounts/test", nil)
+	if resp := request(t, b, s, logical.ReadOperation, "accounts/test", nil); resp != nil {
+		t.Fatalf("expected the account to be deleted, got %v", resp.Data)
+	}
+	if resp := request(t, b, s, logical.ReadOperation, "addresses/"+testAddress, nil); resp != nil {
+		t.Fatalf("expected the address to be unindexed, got %v", resp.Data)
+	}
+	resp := mustSucceed(t, request(t, b, s, logical.ListOperation, "deleted-accounts/", nil))
+	info := resp.Data["key_info"].(map[string]interface{})["test"].(map[string]interface{})
+	if info["address"] != testAddress || info["deleted_by"] != testEntity {
+		t.Fatalf("unexpected deleted account %v", info)
+	}
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test", map[string]interface{}{
+		"mnemonic": testMnemonic,
+	}))
+
+	resp = mustSucceed(t, request(t, b, s, logical.UpdateOperation, "deleted-accounts/test/restore", nil))
+	if resp.Data["address"] != testAddress {
+		t.Fatalf("unexpected restored account %v", resp.Data)
+	}
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/test/nonces/1", nil))
+	if resp.Data["next"] != uint64(3) {
+		t.Fatalf("expected the counter to be kept, got %v", resp.Data)
+	}
+	mustSucceed(t, request(t, b, s, logical.ReadOperation, "addresses/"+testAddress, nil))
+	if resp := request(t, b, s, logical.ReadOperation, "deleted-accounts/test", nil); resp != nil {
+		t.Fatalf("expected the tombstone to be removed, got %v", resp.Data)
+	}
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "deleted-accounts/test/restore", nil))
+}
+
+func TestAccountRestoreRejectsTakenAddress(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	request(t, b, s, logical.DeleteOperation, "accounts/test", nil)
+	createTestAccount(t, b, s, "other")
+
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "deleted-accounts/test/restore", nil))
+	if resp := request(t, b, s, logical.ReadOperation, "accounts/test", nil); resp != nil {
+		t.Fatalf("expected the account not to be restored, got %v", resp.Data)
+	}
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "addresses/"+testAddress, nil))
+	if resp.Data["account"] != "other" {
+		t.Fatalf("expected the address to stay with other, got %v", resp.Data)
+	}
+}
+
+func TestDeletedAccountPurge(t *testing.T) {
+	b, s := getTestBackend(t)
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "config/deletion", nil))
+	if resp.Data["retention"] != int64(DefaultDeletionRetention.Seconds()) {
+		t.Fatalf("unexpected default retention %v", resp.Data)
+	}
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "config/deletion", map[string]interface{}{"retention": 0}))
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "config/deletion", map[string]interface{}{"retention": "1h"}))
+
+	createTestAccount(t, b, s, "test")
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/kept", map[string]interface{}{
+		"private_key": hexutil.Encode(cowKey),
+	}))
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/nonces/1", nil))
+	request(t, b, s, logical.DeleteOperation, "accounts/test", nil)
+	request(t, b, s, logical.DeleteOperation, "accounts/kept", nil)
+
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "deleted-accounts/kept", nil))
+	purgeAt, err := time.Parse(time.RFC3339, resp.Data["purge_at"].(string))
+	if err != nil || purgeAt.Before(time.Now().Add(59*time.Minute)) {
+		t.Fatalf("expected the account to be kept for an hour, got %v", resp.Data["purge_at"])
+	}
+
+	expirePurge(t, b, s, "deleted-accounts/test", &DeletedAccount{})
+	if resp := request(t, b, s, logical.ReadOperation, "deleted-accounts/test", nil); resp != nil {
+		t.Fatalf("expected the account to be purged, got %v", resp.Data)
+	}
+	if keys, err := s.List(context.Background(), "nonces/test/"); err != nil || len(keys) != 0 {
+		t.Fatalf("expected the counters to be purged, got %v, %v", keys, err)
+	}
+	mustSucceed(t, request(t, b, s, logical.ReadOperation, "deleted-accounts/kept", nil))
+
+	request(t, b, s, logical.DeleteOperation, "deleted-accounts/kept", nil)
+	if resp := request(t, b, s, logical.ReadOperation, "deleted-accounts/kept", nil); resp != nil {
+		t.Fatalf("expected the account to be purged, got %v", resp.Data)
+	}
+	createTestAccount(t, b, s, "kept")
+}
+
+func TestRevokedAccountSkipsDeletedAccounts(t *testing.T) {
+	b, s := getTestBackend(t)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "roles/ci", map[string]interface{}{}))
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "creds/ci", nil))
+	name := resp.Data["account"].(string)
+
+	revoke(t, b, s, resp.Secret)
+	if resp := request(t, b, s, logical.ReadOperation, "deleted-accounts/"+name, nil); resp != nil {
+		t.Fatalf("expected the revoked account to be purged, got %v", resp.Data)
+	}
+	if resp := request(t, b, s, logical.ReadOperation, "addresses/"+resp.Data["address"].(string), nil); resp != nil {
+		t.Fatalf("expected the address to be unindexed, got %v", resp.Data)
+	}
+}
+
+func TestWalletSoftDelete(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestWallet(t, b, s)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "wallets/w/accounts", map[string]interface{}{"count": 2}))
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "wallets/w/accounts/1/nonces/1", map[string]interface{}{
+		"next": 4,
+	}))
+
+	request(t, b, s, logical.DeleteOperation, "wallets/w", nil)
+	mustFail(t, signTxAt(t, b, s, "wallets/w/accounts/1", "1", nil))
+	if resp := request(t, b, s, logical.ReadOperation, "addresses/"+testRecipient, nil); resp != nil {
+		t.Fatalf("expected the address to be unindexed, got %v", resp.Data)
+	}
+	resp := mustSucceed(t, request(t, b, s, logical.ListOperation, "deleted-wallets/", nil))
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "w" {
+		t.Fatalf("unexpected deleted wallets %v", keys)
+	}
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "wallets/w", map[string]interface{}{"mnemonic": testMnemonic}))
+
+	// the first account of the wallet holds the key of a new account meanwhile
+	createTestAccount(t, b, s, "test")
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "deleted-wallets/w/restore", nil))
+	request(t, b, s, logical.DeleteOperation, "accounts/test", nil)
+
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "deleted-wallets/w/restore", nil))
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "addresses/"+testRecipient, nil))
+	if resp.Data["account"] != "w/1" {
+		t.Fatalf("expected the addresses to be indexed again, got %v", resp.Data)
+	}
+	tx := signedTransaction(t, signTxAt(t, b, s, "wallets/w/accounts/1", "1", map[string]interface{}{"nonce": nil}))
+	if tx.Nonce() != 4 {
+		t.Fatalf("expected the counter to be kept, got nonce %d", tx.Nonce())
+	}
+}
+
+func TestDeletedWalletPurge(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestWallet(t, b, s)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "wallets/w/accounts", map[string]interface{}{"count": 2}))
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "wallets/w/accounts/1/nonces/1", nil))
+	request(t, b, s, logical.DeleteOperation, "wallets/w", nil)
+
+	expirePurge(t, b, s, "deleted-wallets/w", &DeletedWallet{})
+	if resp := request(t, b, s, logical.ReadOperation, "deleted-wallets/w", nil); resp != nil {
+		t.Fatalf("expected the wallet to be purged, got %v", resp.Data)
+	}
+	ctx := context.Background()
+	for _, prefix := range []string{"wallet-addresses/w/", "wallet-nonces/w/"} {
+		if keys, err := s.List(ctx, prefix); err != nil || len(keys) != 0 {
+			t.Fatalf("expected %s to be empty, got %v, %v", prefix, keys, err)
+		}
+	}
+	createTestWallet(t, b, s)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// AccountDisabled records why and by whom an account was disabled
+type AccountDisabled struct {
+	Reason   string    `json:"reason,omitempty"`
+	Actor    string    `json:"actor,omitempty"`
+	EntityID string    `json:"entity_id,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// disablePaths returns the disable and enable paths of the account or the
+// wallet matched by pattern. The fields of identity name it in the pattern.
+func disablePaths(b *vaultEthereumBackend, pattern string, identity map[string]*framework.FieldSchema) []*framework.Path {
+	paths := []*framework.Path{
+		{
+			Pattern:      QualifiedPath(pattern + "/disable"),
+			HelpSynopsis: "Disable an account.",
+			HelpDescription: `
+
+A disabled account refuses every sign operation until it is enabled again.
+Its key material is kept. Disabling a wallet disables all of its accounts.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"reason": {
+					Type:        framework.TypeString,
+					Description: "Why the account is disabled.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathAccountDisable,
+				logical.UpdateOperation: b.pathAccountDisable,
+			},
+		},
+		{
+			Pattern:        QualifiedPath(pattern + "/enable"),
+			HelpSynopsis:   "Enable a disabled account.",
+			Fields:         map[string]*framework.FieldSchema{},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathAccountEnable,
+				logical.UpdateOperation: b.pathAccountEnable,
+			},
+		},
+	}
+	return withIdentity(paths, identity)
+}
+
+// disableOwner reads the disabled state managed by a request on the disable
+// paths of an account or of a wallet. It returns a description of the owner
+// and a function storing the state back, which is nil when the owner does not
+// exist.
+func (b *vaultEthereumBackend) disableOwner(ctx context.Context, req *logical.Request, data *framework.FieldData) (string, *AccountDisabled, func(*AccountDisabled) error, error) {
+	if _, ok := data.Schema["wallet"]; ok {
+		name := data.Get("wallet").(string)
+		wallet, err := readWallet(ctx, req.Storage, name)
+		if err != nil || wallet == nil {
+			return "wallet " + name, nil, nil, err
+		}
+		return "wallet " + name, wallet.Disabled, func(disabled *AccountDisabled) error {
+			wallet.Disabled = disabled
+			return writeWallet(ctx, req.Storage, name, wallet)
+		}, nil
+	}
+
+	name := data.Get("name").(string)
+	accountJSON, err := readAccount(ctx, req, name)
+	if err != nil || accountJSON == nil {
+		return "account " + name, nil, nil, err
+	}
+	return "account " + name, accountJSON.Disabled, func(disabled *AccountDisabled) error {
+		accountJSON.Disabled = disabled
+		return b.updateAccount(ctx, req, name, accountJSON)
+	}, nil
+}
+
+// disabledResponse is the error returned by sign operations on a disabled
+// account
+func disabledResponse(name string, disabled *AccountDisabled) *logical.Response {
+	if disabled.Reason == Empty {
+		return logical.ErrorResponse("account %s is disabled", name)
+	}
+	return logical.ErrorResponse("account %s is disabled: %s", name, disabled.Reason)
+}
+
+func (disabled *AccountDisabled) data() map[string]interface{} {
+	if disabled == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"reason":    disabled.Reason,
+		"actor":     disabled.Actor,
+		"entity_id": disabled.EntityID,
+		"time":      disabled.Time.Format(time.RFC3339),
+	}
+}
+
+func (b *vaultEthereumBackend) pathAccountDisable(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	owner, _, save, err := b.disableOwner(ctx, req, data)
+	if err != nil {
+		return nil, err
+	}
+	if save == nil {
+		return logical.ErrorResponse("%s does not exist", owner), nil
+	}
+
+	disabled := &AccountDisabled{
+		Reason:   data.Get("reason").(string),
+		Actor:    req.DisplayName,
+		EntityID: req.EntityID,
+		Time:     time.Now().UTC(),
+	}
+	if err := save(disabled); err != nil {
+		return nil, err
+	}
+	b.Logger().Warn("account disabled", "owner", owner, "actor", req.DisplayName, "reason", disabled.Reason)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"disabled": disabled.data(),
+		},
+	}, nil
+}
+
+func (b *vaultEthereumBackend) pathAccountEnable(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	owner, disabled, save, err := b.disableOwner(ctx, req, data)
+	if err != nil {
+		return nil, err
+	}
+	if save == nil {
+		return logical.ErrorResponse("%s does not exist", owner), nil
+	}
+	if disabled == nil {
+		return nil, nil
+	}
+
+	if err := save(nil); err != nil {
+		return nil, err
+	}
+	b.Logger().Warn("account enabled", "owner", owner, "actor", req.DisplayName)
+	return nil, nil
+}
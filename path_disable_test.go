@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// expectDisabled fails the test unless resp reports a disabled account
+func expectDisabled(t *testing.T, resp *logical.Response) {
+	t.Helper()
+	mustFail(t, resp)
+	if !strings.Contains(resp.Error().Error(), "is disabled") {
+		t.Fatalf("expected a disabled account, got %v", resp.Error())
+	}
+}
+
+func TestAccountDisable(t *testing.T) {
+	b, s := getTestBackend(t)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test", map[string]interface{}{
+		"mnemonic":   testMnemonic,
+		"exportable": true,
+	}))
+	registerTestToken(t, b, s)
+
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/disable", map[string]interface{}{
+		"reason": "key leaked",
+	}))
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/test", nil))
+	disabled := resp.Data["disabled"].(map[string]interface{})
+	if disabled["reason"] != "key leaked" || disabled["actor"] != testEntity || disabled["entity_id"] != testEntity {
+		t.Fatalf("unexpected disabled state %v", disabled)
+	}
+	resp = mustSucceed(t, request(t, b, s, logical.ListOperation, "accounts/", nil))
+	if info := resp.Data["key_info"].(map[string]interface{})["test"].(map[string]interface{}); info["disabled"] != true {
+		t.Fatalf("expected the account to be listed as disabled, got %v", info)
+	}
+
+	expectDisabled(t, signTx(t, b, s, "test", "1", nil))
+	expectDisabled(t, signTxAt(t, b, s, "addresses/"+testAddress, "1", nil))
+	expectDisabled(t, signTransfer(t, b, s, "1", nil))
+	expectDisabled(t, request(t, b, s, logical.UpdateOperation, "accounts/test/sign", map[string]interface{}{
+		"message": "hello",
+	}))
+	expectDisabled(t, request(t, b, s, logical.UpdateOperation, "accounts/test/sign-typed-data", map[string]interface{}{
+		"typed_data": mailTypedData,
+	}))
+	expectDisabled(t, request(t, b, s, logical.UpdateOperation, "accounts/test/export", map[string]interface{}{
+		"passphrase": "secret",
+		"scrypt_n":   keystore.LightScryptN,
+	}))
+	expectDisabled(t, request(t, b, s, logical.UpdateOperation, "accounts/test/send-tx", map[string]interface{}{
+		"chain_id": 1,
+		"to":       testRecipient,
+	}))
+
+	// the state of the account can still be managed
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/nonces/1", map[string]interface{}{"next": 3}))
+	mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/test/spending", nil))
+
+	request(t, b, s, logical.UpdateOperation, "accounts/test/enable", nil)
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/test", nil))
+	if disabled := resp.Data["disabled"].(map[string]interface{}); disabled != nil {
+		t.Fatalf("expected the account to be enabled, got %v", disabled)
+	}
+	mustSucceed(t, signTx(t, b, s, "test", "1", nil))
+
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/missing/disable", nil))
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/missing/enable", nil))
+}
+
+func TestAccountDisableHoldsApprovals(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	writePolicy(t, b, s, map[string]interface{}{
+		"approval_threshold": "100",
+		"required_approvals": 1,
+		"approvers":          "entity-1",
+	})
+	id := heldRequest(t, signTx(t, b, s, "test", "101", nil))
+
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/disable", nil))
+	expectDisabled(t, approve(t, b, s, "entity-1", id))
+	request(t, b, s, logical.UpdateOperation, "accounts/test/enable", nil)
+	signedTransaction(t, approve(t, b, s, "entity-1", id))
+}
+
+func TestWalletDisable(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestWallet(t, b, s)
+
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "wallets/w/disable", map[string]interface{}{
+		"reason": "retired",
+	}))
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "wallets/w", nil))
+	if resp.Data["disabled"].(map[string]interface{})["reason"] != "retired" {
+		t.Fatalf("unexpected wallet %v", resp.Data)
+	}
+	expectDisabled(t, signTxAt(t, b, s, "wallets/w/accounts/1", "1", nil))
+	expectDisabled(t, request(t, b, s, logical.UpdateOperation, "wallets/w/accounts/1/sign", map[string]interface{}{
+		"message": "hello",
+	}))
+
+	request(t, b, s, logical.UpdateOperation, "wallets/w/enable", nil)
+	mustSucceed(t, signTxAt(t, b, s, "wallets/w/accounts/1", "1", nil))
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "wallets/missing/disable", nil))
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"math/big"
+
+	"github.com/bliiitz/vault-ethereum/util"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// erc20Paths returns the sign-erc20-transfer path of the account matched by
+// pattern. The fields of identity name the account in the pattern.
+func erc20Paths(b *vaultEthereumBackend, pattern string, identity map[string]*framework.FieldSchema) []*framework.Path {
+	paths := []*framework.Path{
+		{
+			Pattern:      QualifiedPath(pattern + "/sign-erc20-transfer"),
+			HelpSynopsis: "Sign an ERC-20 token transfer.",
+			HelpDescription: `
+
+Sign a call to transfer(address,uint256) on a registered token contract. The
+amount is human readable (e.g. 12.5) and converted with the decimals the token
+was registered with.
+
+`,
+			Fields:         erc20Fields(),
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathSignERC20Transfer,
+				logical.UpdateOperation: b.pathSignERC20Transfer,
+			},
+		},
+	}
+	return withIdentity(paths, identity)
+}
+
+func (b *vaultEthereumBackend) pathSignERC20Transfer(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	token, err := resolveToken(ctx, req.Storage, data.Get("token").(string))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return logical.ErrorResponse("unknown token %s", data.Get("token")), nil
+	}
+
+	recipient := data.Get("to").(string)
+	if !common.IsHexAddress(recipient) {
+		return logical.ErrorResponse("invalid recipient %s", recipient), nil
+	}
+	amount, err := util.ParseTokenAmount(data.Get("amount").(string), token.Decimals)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	input, err := erc20ABI.Pack("transfer", common.HexToAddress(recipient), amount)
+	if err != nil {
+		return nil, err
+	}
+
+	_, chain, resp, err := resolveChain(ctx, req.Storage, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	txType := TxTypeDynamicFee
+	if chain != nil && chain.TxType != Empty {
+		txType = chain.TxType
+	}
+	if rawTxType, ok := data.GetOk("tx_type"); ok {
+		txType = rawTxType.(string)
+	}
+	if txType != TxTypeLegacy && txType != TxTypeDynamicFee {
+		return logical.ErrorResponse("invalid tx_type %s", txType), nil
+	}
+
+	var build txBuilder = getEIP1559TransactionData
+	if txType == TxTypeLegacy {
+		build = func(data *framework.FieldData, chainID *big.Int) (*types.Transaction, error) {
+			return getTransactionData(data)
+		}
+	}
+
+	resp, err = b.signTxRequest(ctx, req, tokenTransferData(data, token, input), build)
+	if resp == nil || err != nil || resp.IsError() {
+		return resp, err
+	}
+	resp.Data["transfer"] = map[string]interface{}{
+		"token":      token.Address,
+		"symbol":     token.Symbol,
+		"to":         common.HexToAddress(recipient).Hex(),
+		"amount":     data.Get("amount").(string),
+		"raw_amount": amount.String(),
+	}
+	return resp, nil
+}
+
+// erc20Fields are the fields of a token transfer: the shared transaction
+// fields without the calldata and value, which are encoded from token, to and
+// amount
+func erc20Fields() map[string]*framework.FieldSchema {
+	fields := withFields(txFields(), map[string]*framework.FieldSchema{
+		"tx_type": {
+			Type:          framework.TypeString,
+			Description:   "The transaction type: legacy or 1559 - defaults to the type of the chain, or 1559.",
+			AllowedValues: []interface{}{TxTypeLegacy, TxTypeDynamicFee},
+		},
+		"token": {
+			Type:        framework.TypeString,
+			Description: "The name or the address of a registered token.",
+		},
+		"to": {
+			Type:        framework.TypeString,
+			Description: "The address to send the tokens to.",
+		},
+		"amount": {
+			Type:        framework.TypeString,
+			Description: "The amount of tokens, e.g. 12.5.",
+		},
+		"gas_limit": {
+			Type:        framework.TypeString,
+			Description: "The gas limit for the transaction.",
+		},
+		"gas_price": gasPriceField,
+		"max_priority_fee_per_gas": {
+			Type:        framework.TypeString,
+			Description: "The priority fee for EIP-1559 transactions in wei.",
+		},
+		"max_fee_per_gas": {
+			Type:        framework.TypeString,
+			Description: "The fee cap for EIP-1559 transactions in wei.",
+		},
+	})
+	for _, name := range []string{"data", "value", "contract_abi", "method", "args", "bytecode", "constructor_args"} {
+		delete(fields, name)
+	}
+	return fields
+}
+
+// tokenTransferData rewrites a token transfer request into a sign request
+// calling the token contract with input
+func tokenTransferData(data *framework.FieldData, token *TokenConfig, input []byte) *framework.FieldData {
+	raw := make(map[string]interface{}, len(data.Raw)+3)
+	for key, value := range data.Raw {
+		raw[key] = value
+	}
+	raw["to"] = token.Address
+	raw["data"] = hex.EncodeToString(input)
+	raw["value"] = "0"
+
+	return &framework.FieldData{Raw: raw, Schema: withFields(txFields(), data.Schema)}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bliiitz/vault-ethereum/util"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/wrapping"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pborman/uuid"
+)
+
+// DefaultExportWrapTTL is how long the wrapping token of an export lives
+const DefaultExportWrapTTL = 5 * time.Minute
+
+func exportPaths(b *vaultEthereumBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/export"),
+			HelpSynopsis: "Export the account key as an encrypted V3 keystore.",
+			HelpDescription: `
+
+Export returns the private key of the account as a scrypt encrypted V3 JSON
+keystore under the provided passphrase. The account must have been created
+with exportable=true.
+
+The response is always wrapped: Vault returns a single use wrapping token
+that has to be unwrapped to obtain the keystore.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString},
+				"passphrase": {
+					Type:        framework.TypeString,
+					Description: "The passphrase used to encrypt the keystore.",
+				},
+				"scrypt_n": {
+					Type:        framework.TypeInt,
+					Description: "The scrypt CPU/memory cost parameter N - defaults to and may not exceed 262144.",
+					Default:     keystore.StandardScryptN,
+				},
+				"scrypt_p": {
+					Type:        framework.TypeInt,
+					Description: "The scrypt parallelization parameter P - defaults to and may not exceed 1.",
+					Default:     keystore.StandardScryptP,
+				},
+				"wrap_ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "The TTL of the wrapping token - defaults to 5 minutes.",
+					Default:     int(DefaultExportWrapTTL.Seconds()),
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathAccountsExport,
+				logical.UpdateOperation: b.pathAccountsExport,
+			},
+		},
+	}
+}
+
+func (b *vaultEthereumBackend) pathAccountsExport(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	passphrase := data.Get("passphrase").(string)
+	scryptN := data.Get("scrypt_n").(int)
+	scryptP := data.Get("scrypt_p").(int)
+	wrapTTL := time.Duration(data.Get("wrap_ttl").(int)) * time.Second
+
+	if passphrase == Empty {
+		return logical.ErrorResponse("passphrase not specified"), nil
+	}
+	if scryptN <= 1 || scryptN&(scryptN-1) != 0 || scryptN > keystore.StandardScryptN {
+		return logical.ErrorResponse("scrypt_n must be a power of 2 between 2 and %d", keystore.StandardScryptN), nil
+	}
+	if scryptP < 1 || scryptP > keystore.StandardScryptP {
+		return logical.ErrorResponse("scrypt_p must be between 1 and %d", keystore.StandardScryptP), nil
+	}
+	if wrapTTL <= 0 {
+		return logical.ErrorResponse("wrap_ttl must be positive"), nil
+	}
+
+	accountJSON, err := readAccount(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	if accountJSON == nil {
+		return logical.ErrorResponse("account %s does not exist", name), nil
+	}
+	if accountJSON.Disabled != nil {
+		return disabledResponse(name, accountJSON.Disabled), nil
+	}
+	if !accountJSON.Exportable {
+		return logical.ErrorResponse("account %s is not exportable", name), logical.ErrPermissionDenied
+	}
+
+	key, address, err := getAccountKey(*accountJSON)
+	if err != nil {
+		return nil, err
+	}
+	defer util.ZeroKey(key)
+
+	keystoreJSON, err := util.EncryptKey(key, &address, uuid.NewRandom(), passphrase, scryptN, scryptP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt key: %v", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"address":  address.Hex(),
+			"keystore": string(keystoreJSON),
+		},
+		WrapInfo: &wrapping.ResponseWrapInfo{
+			TTL: wrapTTL,
+		},
+	}, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestAccountExport(t *testing.T) {
+	b, s := getTestBackend(t)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test", map[string]interface{}{
+		"mnemonic":   testMnemonic,
+		"exportable": true,
+	}))
+
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/export", map[string]interface{}{
+		"passphrase": "secret",
+		"scrypt_n":   keystore.LightScryptN,
+		"wrap_ttl":   60,
+	}))
+	if resp.WrapInfo == nil || resp.WrapInfo.TTL != time.Minute {
+		t.Fatalf("expected a response wrapped for a minute, got %v", resp.WrapInfo)
+	}
+	key, err := keystore.DecryptKey([]byte(resp.Data["keystore"].(string)), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address := crypto.PubkeyToAddress(key.PrivateKey.PublicKey).Hex(); address != testAddress || resp.Data["address"] != testAddress {
+		t.Fatalf("expected the key of %s, got %s", testAddress, address)
+	}
+}
+
+func TestAccountExportRequiresExportable(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "accounts/test/export",
+		Storage:   s,
+		Data:      map[string]interface{}{"passphrase": "secret"},
+	})
+	if err != logical.ErrPermissionDenied || resp == nil || !resp.IsError() {
+		t.Fatalf("expected permission denied, got %v, %v", resp, err)
+	}
+}
+
+func TestAccountExportRejectsInvalidParameters(t *testing.T) {
+	b, s := getTestBackend(t)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test", map[string]interface{}{
+		"mnemonic":   testMnemonic,
+		"exportable": true,
+	}))
+
+	for _, data := range []map[string]interface{}{
+		{},
+		{"passphrase": "secret", "scrypt_n": 3000},
+		{"passphrase": "secret", "scrypt_n": keystore.StandardScryptN * 2},
+		{"passphrase": "secret", "scrypt_p": 2},
+		{"passphrase": "secret", "wrap_ttl": 0},
+	} {
+		mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test/export", data))
+	}
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/missing/export", map[string]interface{}{
+		"passphrase": "secret",
+	}))
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// noncePaths returns the nonce paths of the account matched by pattern. The
+// fields of identity name the account in the pattern.
+func noncePaths(b *vaultEthereumBackend, pattern string, identity map[string]*framework.FieldSchema) []*framework.Path {
+	paths := []*framework.Path{
+		{
+			Pattern: QualifiedPath(pattern + "/nonces/?"),
+			Fields:  map[string]*framework.FieldSchema{},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathNoncesList,
+			},
+			HelpSynopsis: "List the chains on which the nonces of an account are managed",
+			HelpDescription: `
+			All the chain IDs with a nonce counter will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath(pattern + "/nonces/" + `(?P<chain_id>\d+)`),
+			HelpSynopsis: "Manage the nonce counter of an account on a chain.",
+			HelpDescription: `
+
+Once a nonce counter exists for a chain, sign requests for that chain that
+omit the nonce are given the next nonce of the counter. Writing the counter
+resets it to the provided nonce and forgets dropped nonces. Deleting it stops
+managing nonces on that chain.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"chain_id": {
+					Type:        framework.TypeInt64,
+					Description: "The chain ID of the counter.",
+				},
+				"next": {
+					Type:        framework.TypeInt64,
+					Description: "The next nonce to allocate - defaults to 0.",
+					Default:     int64(0),
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathNonceRead,
+				logical.CreateOperation: b.pathNonceReset,
+				logical.UpdateOperation: b.pathNonceReset,
+				logical.DeleteOperation: b.pathNonceDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath(pattern + "/nonces/" + `(?P<chain_id>\d+)` + "/drop"),
+			HelpSynopsis: "Mark an allocated nonce as dropped.",
+			HelpDescription: `
+
+Dropped nonces belong to transactions that will never be mined. They are
+allocated again, lowest first, before the counter advances so that the gap
+they left is refilled.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"chain_id": {
+					Type:        framework.TypeInt64,
+					Description: "The chain ID of the counter.",
+				},
+				"nonce": {
+					Type:        framework.TypeInt64,
+					Description: "The nonce to mark as dropped.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathNonceDrop,
+				logical.UpdateOperation: b.pathNonceDrop,
+			},
+		},
+	}
+	return withIdentity(paths, identity)
+}
+
+func (b *vaultEthereumBackend) pathNoncesList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name, resp, err := requestAccountName(ctx, req.Storage, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	vals, err := req.Storage.List(ctx, nonceRoot(name))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *vaultEthereumBackend) pathNonceRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name, resp, err := requestAccountName(ctx, req.Storage, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	chainID := data.Get("chain_id").(int64)
+
+	b.lock.RLock()
+	counter, err := readNonceCounter(ctx, req.Storage, name, chainID)
+	b.lock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if counter == nil {
+		return nil, nil
+	}
+	return nonceResponse(chainID, counter), nil
+}
+
+func (b *vaultEthereumBackend) pathNonceReset(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	chainID := data.Get("chain_id").(int64)
+	next := data.Get("next").(int64)
+	if next < 0 {
+		return logical.ErrorResponse("invalid next nonce"), nil
+	}
+
+	name, _, resp, err := resolveAccount(ctx, req, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	counter := &NonceCounter{Next: uint64(next)}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := writeNonceCounter(ctx, req.Storage, name, chainID, counter); err != nil {
+		return nil, err
+	}
+	return nonceResponse(chainID, counter), nil
+}
+
+func (b *vaultEthereumBackend) pathNonceDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name, resp, err := requestAccountName(ctx, req.Storage, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	chainID := data.Get("chain_id").(int64)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return nil, req.Storage.Delete(ctx, noncePath(name, chainID))
+}
+
+func (b *vaultEthereumBackend) pathNonceDrop(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name, resp, err := requestAccountName(ctx, req.Storage, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	chainID := data.Get("chain_id").(int64)
+	nonce, ok := data.GetOk("nonce")
+	if !ok || nonce.(int64) < 0 {
+		return logical.ErrorResponse("Nonce not specified"), nil
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	counter, err := readNonceCounter(ctx, req.Storage, name, chainID)
+	if err != nil {
+		return nil, err
+	}
+	if counter == nil {
+		return logical.ErrorResponse("nonces are not managed for account %s on chain %d", name, chainID), nil
+	}
+	if err := counter.drop(uint64(nonce.(int64))); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := writeNonceCounter(ctx, req.Storage, name, chainID, counter); err != nil {
+		return nil, err
+	}
+	return nonceResponse(chainID, counter), nil
+}
+
+func nonceResponse(chainID int64, counter *NonceCounter) *logical.Response {
+	dropped := counter.Dropped
+	if dropped == nil {
+		dropped = []uint64{}
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"chain_id": chainID,
+			"next":     counter.Next,
+			"dropped":  dropped,
+		},
+	}
+}
+
+// deleteNonceCounters removes every nonce counter of an account
+func deleteNonceCounters(ctx context.Context, s logical.Storage, name string) error {
+	prefix := nonceRoot(name)
+	chainIDs, err := s.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, chainID := range chainIDs {
+		if err := s.Delete(ctx, prefix+strings.TrimSuffix(chainID, "/")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
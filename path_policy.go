@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bliiitz/vault-ethereum/util"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// policyPaths returns the policy path of the account or the wallet matched by
+// pattern. The fields of identity name the account or the wallet.
+func policyPaths(b *vaultEthereumBackend, pattern string, identity map[string]*framework.FieldSchema) []*framework.Path {
+	paths := []*framework.Path{
+		{
+			Pattern:      QualifiedPath(pattern + "/policy"),
+			HelpSynopsis: "Manage the transaction signing policy of an account or a wallet.",
+			HelpDescription: `
+
+The policy is evaluated before any transaction is signed by the account.
+Transactions violating a rule are rejected with an error naming the rule.
+Rules that are not set do not restrict anything.
+
+The policy of a wallet applies to each of its accounts. Spending limits are
+tracked per account.
+
+Call rules decode the calldata of transactions against the registered ABIs
+(see abis/) to match methods by name or signature. Transactions without
+calldata are only matched by <address>:* rules, and deployments are rejected
+while allowed_calls is set.
+
+When required_approvals is set, transactions above approval_threshold are not
+signed right away: they are held as requests (see requests/) until enough
+distinct approvers approve them. ERC-20 transfers and approvals are held when
+their amount exceeds the token_approval_thresholds of their token, or always
+when their token has none.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"allowed_to": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The addresses transactions may be sent to.",
+				},
+				"allowed_chain_ids": {
+					Type:        framework.TypeCommaIntSlice,
+					Description: "The chain IDs transactions may be signed for.",
+				},
+				"max_value": {
+					Type:        framework.TypeString,
+					Description: "The maximum value of a transaction in wei.",
+				},
+				"max_gas_price": {
+					Type:        framework.TypeString,
+					Description: "The maximum gas price (or max fee per gas for EIP-1559) in wei.",
+				},
+				"max_gas_limit": {
+					Type:        framework.TypeInt,
+					Description: "The maximum gas limit of a transaction.",
+				},
+				"spending_limits": {
+					Type:        framework.TypeKVPairs,
+					Description: "The maximum value in wei signed per rolling window on each chain, keyed by window (e.g. 24h=10000000000000000000).",
+				},
+				"max_token_amounts": {
+					Type:        framework.TypeKVPairs,
+					Description: "The maximum amount of a registered token transferred or approved by a single transaction, keyed by token name or address (e.g. usdc=1000.5). The cap is per transaction, not cumulative.",
+				},
+				"allowed_calls": {
+					Type:        framework.TypeStringSlice,
+					Description: "The contract calls transactions may make, one rule per value, as <address>:<method> where address may be * and method is a name, a signature, a 0x selector or *.",
+				},
+				"denied_calls": {
+					Type:        framework.TypeStringSlice,
+					Description: "The contract calls transactions may not make, in the same form as allowed_calls.",
+				},
+				"deny_unknown_selectors": {
+					Type:        framework.TypeBool,
+					Description: "Reject calldata whose selector is not declared by a registered ABI.",
+				},
+				"approval_threshold": {
+					Type:        framework.TypeString,
+					Description: "The value in wei above which transactions need approvals. If empty, every transaction needs approvals.",
+				},
+				"token_approval_thresholds": {
+					Type:        framework.TypeKVPairs,
+					Description: "The amount of a registered token above which a transfer or an approval needs approvals, keyed by token name or address (e.g. usdc=1000.5).",
+				},
+				"required_approvals": {
+					Type:        framework.TypeInt,
+					Description: "The number of distinct approvers a transaction above the threshold needs. 0 disables approvals.",
+				},
+				"approvers": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The Vault entity IDs allowed to approve. If empty, any entity other than the requester may approve.",
+				},
+				"approval_ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "How long a request waits for approvals. Defaults to 24h.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathPolicyRead,
+				logical.CreateOperation: b.pathPolicyWrite,
+				logical.UpdateOperation: b.pathPolicyWrite,
+				logical.DeleteOperation: b.pathPolicyDelete,
+			},
+		},
+	}
+	return withIdentity(paths, identity)
+}
+
+// spendingPaths returns the spending path of the account matched by pattern.
+// The fields of identity name the account in the pattern.
+func spendingPaths(b *vaultEthereumBackend, pattern string, identity map[string]*framework.FieldSchema) []*framework.Path {
+	paths := []*framework.Path{
+		{
+			Pattern:      QualifiedPath(pattern + "/spending"),
+			HelpSynopsis: "Report the usage of the spending limits of an account.",
+			HelpDescription: `
+
+Reports, for every rolling window of the account policy, the value signed
+within the window and the remaining allowance. Usage is tracked per chain.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"chain_id": {
+					Type:        framework.TypeInt64,
+					Description: "Only report the usage on this chain.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathSpendingRead,
+			},
+		},
+	}
+	return withIdentity(paths, identity)
+}
+
+// policyOwner reads the policy managed by a request on the policy path of an
+// account or of a wallet. It returns a description of the owner of the policy
+// and a function storing the policy back, which is nil when the owner does not
+// exist.
+func (b *vaultEthereumBackend) policyOwner(ctx context.Context, req *logical.Request, data *framework.FieldData) (string, *AccountPolicy, func(*AccountPolicy) error, error) {
+	if _, ok := data.Schema["wallet"]; ok {
+		name := data.Get("wallet").(string)
+		wallet, err := readWallet(ctx, req.Storage, name)
+		if err != nil || wallet == nil {
+			return "wallet " + name, nil, nil, err
+		}
+		return "wallet " + name, wallet.Policy, func(policy *AccountPolicy) error {
+			wallet.Policy = policy
+			return writeWallet(ctx, req.Storage, name, wallet)
+		}, nil
+	}
+
+	name := data.Get("name").(string)
+	accountJSON, err := readAccount(ctx, req, name)
+	if err != nil || accountJSON == nil {
+		return "account " + name, nil, nil, err
+	}
+	return "account " + name, accountJSON.Policy, func(policy *AccountPolicy) error {
+		accountJSON.Policy = policy
+		return b.updateAccount(ctx, req, name, accountJSON)
+	}, nil
+}
+
+func (b *vaultEthereumBackend) pathPolicyRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, policy, save, err := b.policyOwner(ctx, req, data)
+	if err != nil {
+		return nil, err
+	}
+	if save == nil {
+		return nil, nil
+	}
+
+	if policy == nil {
+		policy = &AccountPolicy{}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"allowed_to":                policy.AllowedTo,
+			"allowed_chain_ids":         policy.AllowedChainIDs,
+			"max_value":                 policy.MaxValue,
+			"max_gas_price":             policy.MaxGasPrice,
+			"max_gas_limit":             policy.MaxGasLimit,
+			"spending_limits":           spendingLimitsMap(policy.SpendingLimits),
+			"max_token_amounts":         policy.MaxTokenAmounts,
+			"allowed_calls":             policy.AllowedCalls,
+			"denied_calls":              policy.DeniedCalls,
+			"deny_unknown_selectors":    policy.DenyUnknownSelectors,
+			"approval_threshold":        policy.ApprovalThreshold,
+			"token_approval_thresholds": policy.TokenApprovalThresholds,
+			"required_approvals":        policy.RequiredApprovals,
+			"approvers":                 policy.Approvers,
+			"approval_ttl":              int64(policy.ApprovalTTL.Seconds()),
+		},
+	}, nil
+}
+
+func (b *vaultEthereumBackend) pathPolicyWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	owner, policy, save, err := b.policyOwner(ctx, req, data)
+	if err != nil {
+		return nil, err
+	}
+	if save == nil {
+		return logical.ErrorResponse("%s does not exist", owner), nil
+	}
+
+	if policy == nil {
+		policy = &AccountPolicy{}
+	}
+
+	if allowedTo, ok := data.GetOk("allowed_to"); ok {
+		policy.AllowedTo = nil
+		for _, address := range allowedTo.([]string) {
+			if !common.IsHexAddress(address) {
+				return logical.ErrorResponse("invalid address %s in allowed_to", address), nil
+			}
+			policy.AllowedTo = append(policy.AllowedTo, common.HexToAddress(address).Hex())
+		}
+	}
+	if allowedChainIDs, ok := data.GetOk("allowed_chain_ids"); ok {
+		policy.AllowedChainIDs = nil
+		for _, chainID := range allowedChainIDs.([]int) {
+			policy.AllowedChainIDs = append(policy.AllowedChainIDs, int64(chainID))
+		}
+	}
+	if maxValue, ok := data.GetOk("max_value"); ok {
+		if !validAmount(maxValue.(string)) {
+			return logical.ErrorResponse("invalid max_value"), nil
+		}
+		policy.MaxValue = maxValue.(string)
+	}
+	if maxGasPrice, ok := data.GetOk("max_gas_price"); ok {
+		if !validAmount(maxGasPrice.(string)) {
+			return logical.ErrorResponse("invalid max_gas_price"), nil
+		}
+		policy.MaxGasPrice = maxGasPrice.(string)
+	}
+	if maxGasLimit, ok := data.GetOk("max_gas_limit"); ok {
+		if maxGasLimit.(int) < 0 {
+			return logical.ErrorResponse("invalid max_gas_limit"), nil
+		}
+		policy.MaxGasLimit = uint64(maxGasLimit.(int))
+	}
+	if spendingLimits, ok := data.GetOk("spending_limits"); ok {
+		policy.SpendingLimits = nil
+		for window, amount := range spendingLimits.(map[string]string) {
+			duration, err := parseutil.ParseDurationSecond(window)
+			if err != nil || duration <= 0 {
+				return logical.ErrorResponse("invalid spending limit window %s", window), nil
+			}
+			if amount == Empty || !validAmount(amount) {
+				return logical.ErrorResponse("invalid spending limit amount %s", amount), nil
+			}
+			policy.SpendingLimits = append(policy.SpendingLimits, SpendingLimit{Window: duration, Amount: amount})
+		}
+		sort.Slice(policy.SpendingLimits, func(i, j int) bool {
+			return policy.SpendingLimits[i].Window < policy.SpendingLimits[j].Window
+		})
+	}
+	if maxTokenAmounts, ok := data.GetOk("max_token_amounts"); ok {
+		policy.MaxTokenAmounts = nil
+		for name, amount := range maxTokenAmounts.(map[string]string) {
+			token, err := resolveToken(ctx, req.Storage, name)
+			if err != nil {
+				return nil, err
+			}
+			if token == nil {
+				return logical.ErrorResponse("unknown token %s in max_token_amounts", name), nil
+			}
+			maxAmount, err := util.ParseTokenAmount(amount, token.Decimals)
+			if err != nil {
+				return logical.ErrorResponse("invalid max_token_amounts for %s: %v", name, err), nil
+			}
+			if policy.MaxTokenAmounts == nil {
+				policy.MaxTokenAmounts = make(map[string]string)
+			}
+			policy.MaxTokenAmounts[token.Address] = maxAmount.String()
+		}
+	}
+	if allowedCalls, ok := data.GetOk("allowed_calls"); ok {
+		rules, err := normalizeCallRules(allowedCalls.([]string))
+		if err != nil {
+			return logical.ErrorResponse("invalid allowed_calls: %v", err), nil
+		}
+		policy.AllowedCalls = rules
+	}
+	if deniedCalls, ok := data.GetOk("denied_calls"); ok {
+		rules, err := normalizeCallRules(deniedCalls.([]string))
+		if err != nil {
+			return logical.ErrorResponse("invalid denied_calls: %v", err), nil
+		}
+		policy.DeniedCalls = rules
+	}
+	if denyUnknownSelectors, ok := data.GetOk("deny_unknown_selectors"); ok {
+		policy.DenyUnknownSelectors = denyUnknownSelectors.(bool)
+	}
+	if approvalThreshold, ok := data.GetOk("approval_threshold"); ok {
+		if !validAmount(approvalThreshold.(string)) {
+			return logical.ErrorResponse("invalid approval_threshold"), nil
+		}
+		policy.ApprovalThreshold = approvalThreshold.(string)
+	}
+	if tokenApprovalThresholds, ok := data.GetOk("token_approval_thresholds"); ok {
+		policy.TokenApprovalThresholds = nil
+		for name, amount := range tokenApprovalThresholds.(map[string]string) {
+			token, err := resolveToken(ctx, req.Storage, name)
+			if err != nil {
+				return nil, err
+			}
+			if token == nil {
+				return logical.ErrorResponse("unknown token %s in token_approval_thresholds", name), nil
+			}
+			threshold, err := util.ParseTokenAmount(amount, token.Decimals)
+			if err != nil {
+				return logical.ErrorResponse("invalid token_approval_thresholds for %s: %v", name, err), nil
+			}
+			if policy.TokenApprovalThresholds == nil {
+				policy.TokenApprovalThresholds = make(map[string]string)
+			}
+			policy.TokenApprovalThresholds[token.Address] = threshold.String()
+		}
+	}
+	if requiredApprovals, ok := data.GetOk("required_approvals"); ok {
+		if requiredApprovals.(int) < 0 {
+			return logical.ErrorResponse("invalid required_approvals"), nil
+		}
+		policy.RequiredApprovals = requiredApprovals.(int)
+	}
+	if approvers, ok := data.GetOk("approvers"); ok {
+		policy.Approvers = approvers.([]string)
+	}
+	if approvalTTL, ok := data.GetOk("approval_ttl"); ok {
+		if approvalTTL.(int) < 0 {
+			return logical.ErrorResponse("invalid approval_ttl"), nil
+		}
+		policy.ApprovalTTL = time.Duration(approvalTTL.(int)) * time.Second
+	}
+	if len(policy.Approvers) > 0 && len(policy.Approvers) < policy.RequiredApprovals {
+		return logical.ErrorResponse("required_approvals exceeds the number of approvers"), nil
+	}
+
+	if err := save(policy); err != nil {
+		return nil, err
+	}
+	return b.pathPolicyRead(ctx, req, data)
+}
+
+func (b *vaultEthereumBackend) pathPolicyDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, _, save, err := b.policyOwner(ctx, req, data)
+	if err != nil || save == nil {
+		return nil, err
+	}
+	return nil, save(nil)
+}
+
+func (b *vaultEthereumBackend) pathSpendingRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name, accountJSON, resp, err := resolveAccount(ctx, req, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	var limits []SpendingLimit
+	if accountJSON.Policy != nil {
+		limits = accountJSON.Policy.SpendingLimits
+	}
+
+	b.lock.RLock()
+	history, err := readSpendingHistory(ctx, req.Storage, name)
+	b.lock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	chainIDs := history.chainIDs()
+	if chainID, ok := data.GetOk("chain_id"); ok {
+		chainIDs = []int64{chainID.(int64)}
+	}
+
+	now := time.Now()
+	usage := make(map[string]interface{}, len(chainIDs))
+	for _, chainID := range chainIDs {
+		usage[strconv.FormatInt(chainID, 10)] = history.usage(now, limits, chainID)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"spending_limits": spendingLimitsMap(limits),
+			"usage":           usage,
+		},
+	}, nil
+}
+
+// spendingLimitsMap renders spending limits the way they are written
+func spendingLimitsMap(limits []SpendingLimit) map[string]string {
+	out := make(map[string]string, len(limits))
+	for _, limit := range limits {
+		out[limit.Window.String()] = limit.Amount
+	}
+	return out
+}
+
+// validAmount returns true for an empty string, which clears a limit, or a
+// non-negative decimal integer
+func validAmount(amount string) bool {
+	if amount == Empty {
+		return true
+	}
+	value, ok := new(big.Int).SetString(amount, 10)
+	return ok && value.Sign() >= 0
+}
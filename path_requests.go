@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func requestPaths(b *vaultEthereumBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("requests/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathRequestsList,
+			},
+			HelpSynopsis: "List the transactions waiting for approvals",
+			HelpDescription: `
+			All the pending and released requests will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("requests/" + framework.GenericNameRegex("id")),
+			HelpSynopsis: "Read or cancel a request.",
+			HelpDescription: `
+
+Reads a transaction held for approvals, decoded against the registered ABIs,
+along with the approvals it received. Once released the request also holds
+the signed transaction. Deleting a request cancels it.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"id": {Type: framework.TypeString},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathRequestRead,
+				logical.DeleteOperation: b.pathRequestDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("requests/" + framework.GenericNameRegex("id") + "/approve"),
+			HelpSynopsis: "Approve a request.",
+			HelpDescription: `
+
+Records the approval of the calling Vault entity. The requester cannot
+approve its own request and each entity approves once. When the request
+reaches the number of approvals required by the account policy, the
+transaction is checked against the policy again, signed and returned. The
+signed transaction is not broadcast.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"id": {Type: framework.TypeString},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathRequestApprove,
+				logical.UpdateOperation: b.pathRequestApprove,
+			},
+		},
+	}
+}
+
+func (b *vaultEthereumBackend) pathRequestsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, QualifiedPath("requests/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *vaultEthereumBackend) pathRequestRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.requestLock.Lock()
+	defer b.requestLock.Unlock()
+
+	request, err := readApprovalRequest(ctx, req.Storage, data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return nil, nil
+	}
+	return approvalRequestResponse(ctx, req.Storage, request)
+}
+
+func (b *vaultEthereumBackend) pathRequestDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.requestLock.Lock()
+	defer b.requestLock.Unlock()
+
+	return nil, req.Storage.Delete(ctx, requestPath(data.Get("id").(string)))
+}
+
+func (b *vaultEthereumBackend) pathRequestApprove(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	id := data.Get("id").(string)
+
+	b.requestLock.Lock()
+	defer b.requestLock.Unlock()
+
+	request, err := readApprovalRequest(ctx, req.Storage, id)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return logical.ErrorResponse("request %s does not exist", id), nil
+	}
+	if request.Status != RequestStatusPending {
+		return logical.ErrorResponse("request %s is already %s", id, request.Status), nil
+	}
+	if time.Now().After(request.ExpiresAt) {
+		if err := req.Storage.Delete(ctx, requestPath(id)); err != nil {
+			return nil, err
+		}
+		return logical.ErrorResponse("request %s expired at %s", id, request.ExpiresAt.Format(time.RFC3339)), nil
+	}
+
+	accountJSON, err := loadAccount(ctx, req, request.Account)
+	if err != nil {
+		return nil, err
+	}
+	if accountJSON == nil {
+		return logical.ErrorResponse("account %s does not exist", request.Account), nil
+	}
+	if accountJSON.Disabled != nil {
+		return disabledResponse(request.Account, accountJSON.Disabled), nil
+	}
+
+	if req.EntityID == Empty {
+		return logical.ErrorResponse("approvals require a Vault entity"), nil
+	}
+	if req.EntityID == request.RequestedBy {
+		return logical.ErrorResponse("the requester cannot approve request %s", id), nil
+	}
+	policy := accountJSON.Policy
+	if policy == nil {
+		policy = &AccountPolicy{}
+	}
+	if !policy.canApprove(req.EntityID) {
+		return logical.ErrorResponse("entity %s is not an approver of account %s", req.EntityID, request.Account), nil
+	}
+	for _, approval := range request.Approvals {
+		if approval.EntityID == req.EntityID {
+			return logical.ErrorResponse("entity %s already approved request %s", req.EntityID, id), nil
+		}
+	}
+
+	request.Approvals = append(request.Approvals, Approval{
+		EntityID:    req.EntityID,
+		DisplayName: req.DisplayName,
+		Time:        time.Now().UTC(),
+	})
+	if len(request.Approvals) < request.RequiredApprovals {
+		if err := writeApprovalRequest(ctx, req.Storage, request); err != nil {
+			return nil, err
+		}
+		return approvalRequestResponse(ctx, req.Storage, request)
+	}
+
+	// The policy may have changed since the request was made, so the
+	// transaction is checked again before it is released
+	tx, err := request.transaction()
+	if err != nil {
+		return nil, err
+	}
+	chainID := big.NewInt(request.ChainID)
+	_, chain, _, err := readChainByID(ctx, req.Storage, request.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	violation, err := checkTransaction(ctx, req.Storage, accountJSON, chain, chainID, tx)
+	if err != nil {
+		return nil, err
+	}
+	if violation != nil {
+		return violation.Response(), nil
+	}
+
+	signedTx, resp, err := b.signChecked(ctx, req.Storage, request.Account, accountJSON, chainID, tx, request.NonceSet)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	resp, err = signedTxResponse(signedTx, chainID)
+	if err != nil {
+		return nil, err
+	}
+	request.Status = RequestStatusReleased
+	request.SignedTransaction = resp.Data["rlpSignature"].(string)
+	if err := writeApprovalRequest(ctx, req.Storage, request); err != nil {
+		return nil, err
+	}
+	resp.Data["request_id"] = request.ID
+	resp.Data["status"] = request.Status
+	return resp, nil
+}
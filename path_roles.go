@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// RoleConfig describes the ephemeral accounts issued by creds/<role>
+type RoleConfig struct {
+	TTL     time.Duration `json:"ttl"`
+	MaxTTL  time.Duration `json:"max_ttl"`
+	SweepTo string        `json:"sweep_to,omitempty"`
+	Chain   string        `json:"chain,omitempty"`
+}
+
+func rolePaths(b *vaultEthereumBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("roles/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathRolesList,
+			},
+			HelpSynopsis: "List the roles issuing ephemeral accounts",
+			HelpDescription: `
+			All the roles will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("roles/" + framework.GenericNameRegex("name")),
+			HelpSynopsis: "Manage a role issuing ephemeral accounts.",
+			HelpDescription: `
+
+Reading creds/<role> generates a throwaway account backed by a Vault lease.
+When the lease ends the account is deleted. If sweep_to is set, the balance
+left on the account is first sent to sweep_to on the chain of the role.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString},
+				"ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "The TTL of the lease of an account. Defaults to the TTL of the mount.",
+				},
+				"max_ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "The maximum TTL of the lease of an account. Defaults to the maximum TTL of the mount.",
+				},
+				"sweep_to": {
+					Type:        framework.TypeString,
+					Description: "The address the balance of an account is sent to when its lease ends.",
+				},
+				"chain": {
+					Type:        framework.TypeString,
+					Description: "The registered chain the balance is swept on. Required with sweep_to.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathRoleRead,
+				logical.CreateOperation: b.pathRoleWrite,
+				logical.UpdateOperation: b.pathRoleWrite,
+				logical.DeleteOperation: b.pathRoleDelete,
+			},
+		},
+	}
+}
+
+func rolePath(name string) string {
+	return QualifiedPath(fmt.Sprintf("roles/%s", name))
+}
+
+func readRole(ctx context.Context, s logical.Storage, name string) (*RoleConfig, error) {
+	entry, err := s.Get(ctx, rolePath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var role RoleConfig
+	if err := entry.DecodeJSON(&role); err != nil {
+		return nil, fmt.Errorf("failed to deserialize role %s: %v", name, err)
+	}
+	return &role, nil
+}
+
+func (b *vaultEthereumBackend) pathRolesList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, QualifiedPath("roles/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *vaultEthereumBackend) pathRoleRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	role, err := readRole(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"ttl":      int64(role.TTL.Seconds()),
+			"max_ttl":  int64(role.MaxTTL.Seconds()),
+			"sweep_to": role.SweepTo,
+			"chain":    role.Chain,
+		},
+	}, nil
+}
+
+func (b *vaultEthereumBackend) pathRoleWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	role, err := readRole(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &RoleConfig{}
+	}
+
+	if ttl, ok := data.GetOk("ttl"); ok {
+		role.TTL = time.Duration(ttl.(int)) * time.Second
+	}
+	if maxTTL, ok := data.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(maxTTL.(int)) * time.Second
+	}
+	if role.TTL < 0 || role.MaxTTL < 0 {
+		return logical.ErrorResponse("ttl and max_ttl cannot be negative"), nil
+	}
+	if role.MaxTTL > 0 && role.TTL > role.MaxTTL {
+		return logical.ErrorResponse("ttl cannot exceed max_ttl"), nil
+	}
+	if sweepTo, ok := data.GetOk("sweep_to"); ok {
+		role.SweepTo = Empty
+		if sweepTo.(string) != Empty {
+			if !common.IsHexAddress(sweepTo.(string)) {
+				return logical.ErrorResponse("invalid sweep_to %s", sweepTo), nil
+			}
+			role.SweepTo = common.HexToAddress(sweepTo.(string)).Hex()
+		}
+	}
+	if chainName, ok := data.GetOk("chain"); ok {
+		role.Chain = chainName.(string)
+	}
+	if role.SweepTo != Empty {
+		if role.Chain == Empty {
+			return logical.ErrorResponse("chain not specified for sweep_to"), nil
+		}
+		chain, err := readChain(ctx, req.Storage, role.Chain)
+		if err != nil {
+			return nil, err
+		}
+		if chain == nil {
+			return logical.ErrorResponse("unknown chain %s", role.Chain), nil
+		}
+		if chain.RPCURL == Empty {
+			return logical.ErrorResponse("chain %s has no rpc_url to sweep on", role.Chain), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(rolePath(name), role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	return b.pathRoleRead(ctx, req, data)
+}
+
+func (b *vaultEthereumBackend) pathRoleDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return nil, req.Storage.Delete(ctx, rolePath(data.Get("name").(string)))
+}
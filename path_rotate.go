@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bliiitz/vault-ethereum/util"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// KeyVersion is a key an account held before it was rotated. It can no longer
+// sign but signatures made with it still verify.
+type KeyVersion struct {
+	Version   int         `json:"version"`
+	Account   AccountJSON `json:"account"`
+	RotatedAt time.Time   `json:"rotated_at"`
+}
+
+func rotatePaths(b *vaultEthereumBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/rotate"),
+			HelpSynopsis: "Rotate the key of an account.",
+			HelpDescription: `
+
+Generates a new key for the account. The sign paths use the new key right away
+while the previous keys are kept to verify signatures. The nonce counters of
+the account are reset. The new mnemonic of an HD account has as many words as
+the previous one and keeps its BIP-39 passphrase unless new ones are given.
+
+When a chain is given, the response carries transactions signed by the
+previous key that move its balance to the new address, using the tx_type of
+the chain: the whole balance of each of the given tokens first, then the whole
+ether balance less the fees of all the sweeps. They are not broadcast, and
+they bypass the policy of the account.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString},
+				"entropy_bits": {
+					Type:        framework.TypeInt,
+					Description: "The entropy of the new mnemonic of an HD account: 128 (12 words) to 256 (24 words), in steps of 32. Defaults to the entropy of the previous mnemonic.",
+				},
+				"bip39_passphrase": {
+					Type:        framework.TypeString,
+					Description: "A new BIP-39 passphrase for an HD account. Defaults to the previous passphrase; an empty value removes it.",
+				},
+				"chain": {
+					Type:        framework.TypeString,
+					Description: "The registered chain to sweep the previous address on. It must have an rpc_url.",
+				},
+				"tokens": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The registered tokens, by name or address, to sweep before the ether.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathAccountRotate,
+				logical.UpdateOperation: b.pathAccountRotate,
+			},
+		},
+		{
+			Pattern: QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/keys/?"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathKeyVersionsList,
+			},
+			HelpSynopsis: "List the key versions of an account",
+			HelpDescription: `
+			All the key versions of the account will be listed along with their address.
+			`,
+		},
+	}
+}
+
+func keyVersionPath(name string, version int) string {
+	return QualifiedPath(fmt.Sprintf("key-versions/%s/%d", name, version))
+}
+
+// keyVersion returns the version of the current key of the account. Records
+// written before keys could be rotated hold their first key.
+func (accountJSON AccountJSON) keyVersion() int {
+	if accountJSON.KeyVersion == 0 {
+		return 1
+	}
+	return accountJSON.KeyVersion
+}
+
+// keyMaterial returns a copy of the account holding only its key
+func (accountJSON AccountJSON) keyMaterial() AccountJSON {
+	return AccountJSON{
+		Type:           accountJSON.Type,
+		Address:        accountJSON.Address,
+		Index:          accountJSON.Index,
+		DerivationPath: accountJSON.DerivationPath,
+		Mnemonic:       accountJSON.Mnemonic,
+		Passphrase:     accountJSON.Passphrase,
+		PrivateKey:     accountJSON.PrivateKey,
+	}
+}
+
+// readKeyVersions returns the previous keys of the account called name, oldest
+// first
+func readKeyVersions(ctx context.Context, s logical.Storage, name string) ([]*KeyVersion, error) {
+	versions, err := s.List(ctx, QualifiedPath(fmt.Sprintf("key-versions/%s/", name)))
+	if err != nil {
+		return nil, err
+	}
+	var keyVersions []*KeyVersion
+	for _, version := range versions {
+		entry, err := s.Get(ctx, QualifiedPath(fmt.Sprintf("key-versions/%s/%s", name, version)))
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+		var keyVersion KeyVersion
+		if err := entry.DecodeJSON(&keyVersion); err != nil {
+			return nil, fmt.Errorf("failed to deserialize key version %s of account %s: %v", version, name, err)
+		}
+		keyVersions = append(keyVersions, &keyVersion)
+	}
+	sort.Slice(keyVersions, func(i, j int) bool {
+		return keyVersions[i].Version < keyVersions[j].Version
+	})
+	return keyVersions, nil
+}
+
+// deleteKeyVersions removes the previous keys of the account called name
+func deleteKeyVersions(ctx context.Context, s logical.Storage, name string) error {
+	prefix := QualifiedPath(fmt.Sprintf("key-versions/%s/", name))
+	versions, err := s.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, version := range versions {
+		if err := s.Delete(ctx, prefix+version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mnemonicEntropyBits returns the entropy of a BIP-39 mnemonic, which has
+// 3 words per 32 bits
+func mnemonicEntropyBits(mnemonic string) int {
+	return len(strings.Fields(mnemonic)) * 32 / 3
+}
+
+// rotateKey replaces the key of an account by a new key of the same type. An
+// HD account keeps its derivation path and its BIP-39 passphrase.
+func rotateKey(accountJSON *AccountJSON, entropyBits int) (common.Address, error) {
+	switch accountJSON.accountType() {
+	case AccountTypeHD:
+		mnemonic, err := generateMnemonic(entropyBits)
+		if err != nil {
+			return common.Address{}, err
+		}
+		accountJSON.DerivationPath = accountJSON.derivationPath()
+		accountJSON.Mnemonic = mnemonic
+	default:
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return common.Address{}, err
+		}
+		defer util.ZeroKey(key)
+		accountJSON.Type = AccountTypeKey
+		accountJSON.PrivateKey = hex.EncodeToString(crypto.FromECDSA(key))
+	}
+	key, address, err := getAccountKey(*accountJSON)
+	if err != nil {
+		return common.Address{}, err
+	}
+	util.ZeroKey(key)
+	accountJSON.Address = address.Hex()
+	return address, nil
+}
+
+// sweepTransactions signs the transactions moving the balance of an account
+// to a new address on a chain: one per token with a balance, then one for the
+// ether left once the fees of all of them are paid
+func (b *vaultEthereumBackend) sweepTransactions(ctx context.Context, s logical.Storage, accountJSON *AccountJSON, chainName string, tokenNames []string, to common.Address) ([]*types.Transaction, *big.Int, *logical.Response, error) {
+	chain, err := readChain(ctx, s, chainName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if chain == nil || chain.RPCURL == Empty {
+		return nil, nil, logical.ErrorResponse("chain %s is not registered with an rpc_url", chainName), nil
+	}
+	var tokens []common.Address
+	for _, tokenName := range tokenNames {
+		token, err := resolveToken(ctx, s, tokenName)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if token == nil {
+			return nil, nil, logical.ErrorResponse("unknown token %s", tokenName), nil
+		}
+		tokens = append(tokens, common.HexToAddress(token.Address))
+	}
+
+	key, from, err := getAccountKey(*accountJSON)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer util.ZeroKey(key)
+
+	client, err := b.newClient(ctx, chain.RPCURL)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to connect to %s: %v", chain.DisplayName, err)
+	}
+	defer closeClient(client)
+
+	chainID := big.NewInt(chain.ChainID)
+	fees, err := suggestSweepFees(ctx, client, chainID, chain.TxType)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	nonce, err := client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var signedTxs []*types.Transaction
+	reserved := new(big.Int)
+	for _, token := range tokens {
+		signedTx, err := tokenSweepTransaction(ctx, client, key, token, to, nonce, fees)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if signedTx != nil {
+			signedTxs = append(signedTxs, signedTx)
+			reserved.Add(reserved, fees.maxFee(signedTx.Gas()))
+			nonce++
+		}
+	}
+	signedTx, err := sweepTransaction(ctx, client, key, to, nonce, fees, reserved)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if signedTx != nil {
+		signedTxs = append(signedTxs, signedTx)
+	}
+	return signedTxs, chainID, nil, nil
+}
+
+func (b *vaultEthereumBackend) pathAccountRotate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	chainName := data.Get("chain").(string)
+	tokens := data.Get("tokens").([]string)
+	if len(tokens) > 0 && chainName == Empty {
+		return logical.ErrorResponse("tokens require a chain"), nil
+	}
+
+	accountJSON, err := readAccount(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	if accountJSON == nil {
+		return logical.ErrorResponse("account %s does not exist", name), nil
+	}
+	if accountJSON.Disabled != nil {
+		return disabledResponse(name, accountJSON.Disabled), nil
+	}
+	entropyBits := DefaultEntropyBits
+	if accountJSON.accountType() == AccountTypeHD {
+		if bits := mnemonicEntropyBits(accountJSON.Mnemonic); validEntropyBits(bits) {
+			entropyBits = bits
+		}
+		if rawEntropyBits, ok := data.GetOk("entropy_bits"); ok {
+			entropyBits = rawEntropyBits.(int)
+			if !validEntropyBits(entropyBits) {
+				return logical.ErrorResponse("entropy_bits must be 128, 160, 192, 224 or 256"), nil
+			}
+		}
+	} else {
+		_, entropyOk := data.GetOk("entropy_bits")
+		_, passphraseOk := data.GetOk("bip39_passphrase")
+		if entropyOk || passphraseOk {
+			return logical.ErrorResponse("entropy_bits and bip39_passphrase only apply to HD accounts"), nil
+		}
+	}
+	previousAddress, err := accountAddress(accountJSON)
+	if err != nil {
+		return nil, err
+	}
+	accountJSON.Address = previousAddress.Hex()
+	previous := KeyVersion{
+		Version:   accountJSON.keyVersion(),
+		Account:   accountJSON.keyMaterial(),
+		RotatedAt: time.Now().UTC(),
+	}
+
+	if passphrase, ok := data.GetOk("bip39_passphrase"); ok {
+		accountJSON.Passphrase = passphrase.(string)
+	}
+	address, err := rotateKey(accountJSON, entropyBits)
+	if err != nil {
+		return nil, err
+	}
+	accountJSON.KeyVersion = previous.Version + 1
+
+	var sweepTxs []*types.Transaction
+	var chainID *big.Int
+	if chainName != Empty {
+		var resp *logical.Response
+		sweepTxs, chainID, resp, err = b.sweepTransactions(ctx, req.Storage, &previous.Account, chainName, tokens, address)
+		if resp != nil || err != nil {
+			return resp, err
+		}
+	}
+
+	if resp, err := addressConflict(ctx, req.Storage, address, name); resp != nil || err != nil {
+		return resp, err
+	}
+	entry, err := logical.StorageEntryJSON(keyVersionPath(name, previous.Version), &previous)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	if err := b.updateAccount(ctx, req, name, accountJSON); err != nil {
+		return nil, err
+	}
+	if err := unindexAddress(ctx, req.Storage, previousAddress, name); err != nil {
+		return nil, err
+	}
+	if resp, err := indexAddress(ctx, req.Storage, address, name); resp != nil || err != nil {
+		return resp, err
+	}
+	b.lock.Lock()
+	err = deleteNonceCounters(ctx, req.Storage, name)
+	b.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	b.Logger().Info("account key rotated", "account", name, "version", accountJSON.KeyVersion, "previous_address", previousAddress.Hex(), "address", address.Hex(), "actor", req.DisplayName)
+
+	sweeps := make([]map[string]interface{}, 0, len(sweepTxs))
+	for _, signedTx := range sweepTxs {
+		rawTx, err := encodeTransaction(signedTx)
+		if err != nil {
+			return nil, err
+		}
+		sweeps = append(sweeps, map[string]interface{}{
+			"hash":         signedTx.Hash().Hex(),
+			"nonce":        signedTx.Nonce(),
+			"to":           signedTx.To().Hex(),
+			"value":        signedTx.Value().String(),
+			"rlpSignature": rawTx,
+		})
+	}
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"address":          address.Hex(),
+			"previous_address": previousAddress.Hex(),
+			"key_version":      accountJSON.KeyVersion,
+		},
+	}
+	if chainID != nil {
+		resp.Data["chainId"] = chainID
+		resp.Data["sweep_transactions"] = sweeps
+	}
+	return resp, nil
+}
+
+func (b *vaultEthereumBackend) pathKeyVersionsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	accountJSON, err := readAccount(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	if accountJSON == nil {
+		return nil, nil
+	}
+	keyVersions, err := readKeyVersions(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	keyInfo := make(map[string]interface{}, len(keyVersions)+1)
+	for _, keyVersion := range keyVersions {
+		version := strconv.Itoa(keyVersion.Version)
+		keys = append(keys, version)
+		keyInfo[version] = map[string]interface{}{
+			"address":    keyVersion.Account.Address,
+			"rotated_at": keyVersion.RotatedAt.Format(time.RFC3339),
+			"current":    false,
+		}
+	}
+	address, err := accountAddress(accountJSON)
+	if err != nil {
+		return nil, err
+	}
+	version := strconv.Itoa(accountJSON.keyVersion())
+	keys = append(keys, version)
+	keyInfo[version] = map[string]interface{}{
+		"address": address.Hex(),
+		"current": true,
+	}
+	return logical.ListResponseWithInfo(keys, keyInfo), nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestAccountRotate(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	signature := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/sign", map[string]interface{}{
+		"message": "hello",
+	})).Data["signature"]
+
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test/rotate", map[string]interface{}{
+		"tokens": "usdc",
+	}))
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test/rotate", map[string]interface{}{
+		"entropy_bits": 100,
+	}))
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/missing/rotate", nil))
+
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/rotate", nil))
+	address := resp.Data["address"].(string)
+	if resp.Data["previous_address"] != testAddress || address == testAddress || resp.Data["key_version"] != 2 {
+		t.Fatalf("unexpected rotation %v", resp.Data)
+	}
+	if _, ok := resp.Data["sweep_transactions"]; ok {
+		t.Fatalf("expected no sweep without a chain, got %v", resp.Data)
+	}
+
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/test", nil))
+	if resp.Data["address"] != address || resp.Data["key_version"] != 2 {
+		t.Fatalf("expected the account to hold the new key, got %v", resp.Data)
+	}
+	tx := signedTransaction(t, signTx(t, b, s, "test", "1", nil))
+	if signer := transactionSigner(t, tx); signer != address {
+		t.Fatalf("expected the transaction to be signed by %s, got %s", address, signer)
+	}
+
+	// the index follows the key
+	if resp := request(t, b, s, logical.ReadOperation, "addresses/"+testAddress, nil); resp != nil {
+		t.Fatalf("expected the previous address to be unindexed, got %v", resp.Data)
+	}
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "addresses/"+address, nil))
+	if resp.Data["account"] != "test" {
+		t.Fatalf("expected the new address to be indexed, got %v", resp.Data)
+	}
+	createTestAccount(t, b, s, "reused")
+
+	resp = mustSucceed(t, request(t, b, s, logical.ListOperation, "accounts/test/keys/", nil))
+	info := resp.Data["key_info"].(map[string]interface{})
+	if info["1"].(map[string]interface{})["address"] != testAddress || info["2"].(map[string]interface{})["current"] != true {
+		t.Fatalf("unexpected key versions %v", info)
+	}
+
+	// signatures of the previous key still verify
+	resp = mustSucceed(t, request(t, b, s, logical.UpdateOperation, "verify", map[string]interface{}{
+		"account":   "test",
+		"message":   "hello",
+		"signature": signature,
+	}))
+	if resp.Data["valid"] != true || resp.Data["key_version"] != 1 {
+		t.Fatalf("expected the signature of the previous key to be valid, got %v", resp.Data)
+	}
+}
+
+func TestAccountRotateResetsNonces(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/nonces/1", map[string]interface{}{
+		"next": 7,
+	}))
+
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/rotate", nil))
+	if keys, err := s.List(context.Background(), "nonces/test/"); err != nil || len(keys) != 0 {
+		t.Fatalf("expected the counters to be reset, got %v, %v", keys, err)
+	}
+}
+
+func TestAccountRotateKeepsHDSettings(t *testing.T) {
+	b, s := getTestBackend(t)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/hd", map[string]interface{}{
+		"entropy_bits":     160,
+		"bip39_passphrase": "secret",
+	}))
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/hd/rotate", nil))
+
+	accountJSON, err := readAccount(context.Background(), &logical.Request{Storage: s}, "hd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mnemonicEntropyBits(accountJSON.Mnemonic) != 160 || accountJSON.Passphrase != "secret" {
+		t.Fatalf("expected the entropy and the passphrase to be kept, got %v", accountJSON)
+	}
+
+	// key accounts have no mnemonic
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/cow", map[string]interface{}{
+		"private_key": hexutil.Encode(cowKey),
+	}))
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/cow/rotate", map[string]interface{}{
+		"entropy_bits": 128,
+	}))
+}
+
+func TestAccountRotateDisabled(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/disable", nil))
+
+	expectDisabled(t, request(t, b, s, logical.UpdateOperation, "accounts/test/rotate", nil))
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/test", nil))
+	if resp.Data["address"] != testAddress {
+		t.Fatalf("expected the key to be kept, got %v", resp.Data)
+	}
+}
+
+func TestAccountRotateSweep(t *testing.T) {
+	b, s := getTestBackend(t)
+	sim := newSimulatedChain(t, b, s, "test")
+	ctx := context.Background()
+
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test/rotate", map[string]interface{}{
+		"chain": "missing",
+	}))
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test/rotate", map[string]interface{}{
+		"chain":  "sim",
+		"tokens": "missing",
+	}))
+
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/rotate", map[string]interface{}{
+		"chain": "sim",
+	}))
+	address := common.HexToAddress(resp.Data["address"].(string))
+	sweeps := resp.Data["sweep_transactions"].([]map[string]interface{})
+	if len(sweeps) != 1 || sweeps[0]["to"] != address.Hex() {
+		t.Fatalf("expected one ether sweep to %s, got %v", address.Hex(), sweeps)
+	}
+
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(hexutil.MustDecode(sweeps[0]["rlpSignature"].(string))); err != nil {
+		t.Fatal(err)
+	}
+	if signer := transactionSigner(t, tx); signer != testAddress {
+		t.Fatalf("expected the sweep to be signed by %s, got %s", testAddress, signer)
+	}
+	if err := sim.SendTransaction(ctx, tx); err != nil {
+		t.Fatal(err)
+	}
+	sim.Commit()
+	receipt, err := sim.TransactionReceipt(ctx, tx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatal("expected the sweep to succeed")
+	}
+	balance, err := sim.BalanceAt(ctx, address, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Cmp(tx.Value()) != 0 || balance.Sign() <= 0 {
+		t.Fatalf("expected the new address to hold %s, got %s", tx.Value(), balance)
+	}
+
+	// the next rotation sweeps the address the first one swept to
+	resp = mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/rotate", map[string]interface{}{
+		"chain": "sim",
+	}))
+	sweeps = resp.Data["sweep_transactions"].([]map[string]interface{})
+	tx = new(types.Transaction)
+	if err := tx.UnmarshalBinary(hexutil.MustDecode(sweeps[0]["rlpSignature"].(string))); err != nil {
+		t.Fatal(err)
+	}
+	if signer := transactionSigner(t, tx); signer != address.Hex() || tx.Value().Cmp(balance) >= 0 {
+		t.Fatalf("expected %s to sweep its balance less the fee, got %s sweeping %s", address.Hex(), signer, tx.Value())
+	}
+}
+
+func TestAccountPurgeRemovesKeyVersions(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/rotate", nil))
+
+	request(t, b, s, logical.DeleteOperation, "accounts/test", nil)
+	if keys, err := s.List(context.Background(), "key-versions/test/"); err != nil || len(keys) != 1 {
+		t.Fatalf("expected the previous keys to be kept until the purge, got %v, %v", keys, err)
+	}
+	request(t, b, s, logical.DeleteOperation, "deleted-accounts/test", nil)
+	if keys, err := s.List(context.Background(), "key-versions/test/"); err != nil || len(keys) != 0 {
+		t.Fatalf("expected the previous keys to be purged, got %v, %v", keys, err)
+	}
+}
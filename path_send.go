@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bliiitz/vault-ethereum/util"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// sendPaths returns the send-tx path of the account matched by pattern. The
+// fields of identity name the account in the pattern.
+func sendPaths(b *vaultEthereumBackend, pattern string, identity map[string]*framework.FieldSchema) []*framework.Path {
+	paths := []*framework.Path{
+		{
+			Pattern:      QualifiedPath(pattern + "/send-tx"),
+			HelpSynopsis: "Sign a transaction and broadcast it.",
+			HelpDescription: `
+
+Sign a transaction and submit it with eth_sendRawTransaction to the JSON-RPC
+endpoint configured for the chain. The chain must be registered with an
+rpc_url.
+
+The nonce, the gas limit and the fees are filled in from the node when they
+are omitted: eth_getTransactionCount (unless nonces are managed by the
+plugin), eth_estimateGas and eth_feeHistory.
+
+`,
+			Fields: withFields(txFields(), map[string]*framework.FieldSchema{
+				"tx_type": {
+					Type:          framework.TypeString,
+					Description:   "The transaction type: legacy or 1559 - defaults to the type of the chain.",
+					AllowedValues: []interface{}{TxTypeLegacy, TxTypeDynamicFee},
+				},
+				"nonce": {
+					Type:        framework.TypeInt64,
+					Description: "The transaction nonce - defaults to the pending nonce of the account.",
+				},
+				"gas_limit": {
+					Type:        framework.TypeString,
+					Description: "The gas limit for the transaction - defaults to the estimate of the node.",
+				},
+				"gas_price": {
+					Type:        framework.TypeString,
+					Description: "The gas price for legacy transactions in wei - defaults to the suggestion of the node.",
+				},
+				"max_priority_fee_per_gas": {
+					Type:        framework.TypeString,
+					Description: "The priority fee for EIP-1559 transactions in wei - defaults to the fee history of the node.",
+				},
+				"max_fee_per_gas": {
+					Type:        framework.TypeString,
+					Description: "The fee cap for EIP-1559 transactions in wei - defaults to the fee history of the node.",
+				},
+				"access_list": {
+					Type:        framework.TypeString,
+					Description: "The access list of EIP-1559 transactions as JSON: [{\"address\": \"0x...\", \"storageKeys\": [\"0x...\"]}].",
+				},
+			}),
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathSendTx,
+				logical.UpdateOperation: b.pathSendTx,
+			},
+		},
+	}
+	return withIdentity(paths, identity)
+}
+
+func (b *vaultEthereumBackend) pathSendTx(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name, accountJSON, resp, err := resolveSigner(ctx, req, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	chainID, chain, resp, err := resolveChain(ctx, req.Storage, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	if chain == nil || chain.RPCURL == Empty {
+		return logical.ErrorResponse("no rpc_url configured for chain %s", chainID), nil
+	}
+
+	call, err := encodeContractCall(ctx, req.Storage, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	txType := chain.TxType
+	if rawTxType, ok := data.GetOk("tx_type"); ok {
+		txType = rawTxType.(string)
+	}
+	if txType != TxTypeLegacy && txType != TxTypeDynamicFee {
+		return logical.ErrorResponse("invalid tx_type %s", txType), nil
+	}
+	if accessList, ok := data.GetOk("access_list"); ok && accessList.(string) != Empty && txType == TxTypeLegacy {
+		return logical.ErrorResponse("access_list is not supported by legacy transactions"), nil
+	}
+
+	key, from, err := getAccountKey(*accountJSON)
+	if err != nil {
+		return nil, err
+	}
+	util.ZeroKey(key)
+
+	client, err := b.newClient(ctx, chain.RPCURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", chain.DisplayName, err)
+	}
+	defer closeClient(client)
+
+	if err := fillTransactionData(ctx, client, data, from, txType); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	_, nonceSet := data.GetOk("nonce")
+	managedNonce := false
+	if !nonceSet {
+		b.lock.RLock()
+		counter, err := readNonceCounter(ctx, req.Storage, name, chainID.Int64())
+		b.lock.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+		if counter == nil {
+			nonce, err := client.PendingNonceAt(ctx, from)
+			if err != nil {
+				return logical.ErrorResponse("failed to fetch nonce: %v", err), nil
+			}
+			data.Raw["nonce"] = int64(nonce)
+			nonceSet = true
+		} else {
+			managedNonce = true
+		}
+	}
+
+	var tx *types.Transaction
+	if txType == TxTypeLegacy {
+		tx, err = getTransactionData(data)
+	} else {
+		tx, err = getEIP1559TransactionData(data, chainID)
+	}
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	signedTx, resp, err := b.signTransaction(ctx, req, name, accountJSON, chain, chainID, tx, nonceSet)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	if err := client.SendTransaction(ctx, signedTx); err != nil {
+		if managedNonce {
+			b.releaseNonce(ctx, req.Storage, name, chainID.Int64(), signedTx.Nonce())
+		}
+		b.releaseSpending(ctx, req.Storage, name, signedTx.Hash())
+		return logical.ErrorResponse("failed to broadcast transaction: %v", err), nil
+	}
+
+	resp, err = signedTxResponse(signedTx, chainID)
+	if err != nil {
+		return nil, err
+	}
+	resp.Data["transactionHash"] = signedTx.Hash().Hex()
+	resp.Data["nonce"] = signedTx.Nonce()
+	if call != nil {
+		resp.Data["call"] = call
+	}
+	return resp, nil
+}
+
+// releaseNonce marks a managed nonce as dropped after its transaction could
+// not be broadcast, so the next request reuses it
+func (b *vaultEthereumBackend) releaseNonce(ctx context.Context, s logical.Storage, name string, chainID int64, nonce uint64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	counter, err := readNonceCounter(ctx, s, name, chainID)
+	if err != nil || counter == nil {
+		return
+	}
+	if err := counter.drop(nonce); err != nil {
+		return
+	}
+	if err := writeNonceCounter(ctx, s, name, chainID, counter); err != nil {
+		b.Logger().Warn("failed to release nonce", "account", name, "chain_id", chainID, "nonce", nonce, "error", err)
+	}
+}
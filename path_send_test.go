@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// simulatedChainID is the chain ID of the simulated backend
+const simulatedChainID = 1337
+
+// simClient hides the Close method of the simulated backend so that the
+// backend survives the requests that close their client
+type simClient struct {
+	ethClient
+}
+
+// pricedClient suggests a fixed legacy gas price
+type pricedClient struct {
+	ethClient
+	gasPrice *big.Int
+}
+
+func (c pricedClient) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return c.gasPrice, nil
+}
+
+// feeHistoryClient answers eth_feeHistory with fixed fees
+type feeHistoryClient struct {
+	ethClient
+	baseFee *big.Int
+	tip     *big.Int
+}
+
+func (c feeHistoryClient) FeeHistory(ctx context.Context, blocks uint64, percentile float64) (*big.Int, *big.Int, error) {
+	return c.baseFee, c.tip, nil
+}
+
+// failingClient refuses to broadcast transactions
+type failingClient struct {
+	ethClient
+}
+
+func (failingClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return errors.New("nonce too low")
+}
+
+// newSimulatedChain creates the account called name, funds it on a simulated
+// backend and registers the backend as the chain sim
+func newSimulatedChain(t *testing.T, b *vaultEthereumBackend, s logical.Storage, name string) *backends.SimulatedBackend {
+	t.Helper()
+	createTestAccount(t, b, s, name)
+	balance := new(big.Int).Mul(big.NewInt(100), big.NewInt(1e18))
+	sim := backends.NewSimulatedBackend(core.GenesisAlloc{
+		common.HexToAddress(testAddress): {Balance: balance},
+	}, 8000000)
+	t.Cleanup(func() { sim.Close() })
+	b.newClient = func(ctx context.Context, rpcURL string) (ethClient, error) {
+		return simClient{sim}, nil
+	}
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "config/chains/sim", map[string]interface{}{
+		"chain_id": simulatedChainID,
+		"rpc_url":  "http://127.0.0.1:8545",
+	}))
+	return sim
+}
+
+// sentTransaction decodes the transaction of a send-tx response
+func sentTransaction(t *testing.T, resp *logical.Response) *types.Transaction {
+	t.Helper()
+	tx := signedTransaction(t, resp)
+	if resp.Data["transactionHash"] != tx.Hash().Hex() {
+		t.Fatalf("expected hash %s, got %v", tx.Hash().Hex(), resp.Data["transactionHash"])
+	}
+	return tx
+}
+
+// sendTx sends 1000 wei to testRecipient on the simulated chain with the
+// account called test. The fields of data override the defaults, and nil
+// fields remove them.
+func sendTx(t *testing.T, b *vaultEthereumBackend, s logical.Storage, data map[string]interface{}) *logical.Response {
+	t.Helper()
+	fields := map[string]interface{}{
+		"chain": "sim",
+		"to":    testRecipient,
+		"value": "1000",
+	}
+	for field, value := range data {
+		if value == nil {
+			delete(fields, field)
+			continue
+		}
+		fields[field] = value
+	}
+	return request(t, b, s, logical.UpdateOperation, "accounts/test/send-tx", fields)
+}
+
+func TestSendTxFillsDynamicFees(t *testing.T) {
+	b, s := getTestBackend(t)
+	sim := newSimulatedChain(t, b, s, "test")
+	ctx := context.Background()
+	head, err := sim.HeaderByNumber(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tip, err := sim.SuggestGasTipCap(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := sentTransaction(t, sendTx(t, b, s, nil))
+	if tx.Type() != types.DynamicFeeTxType {
+		t.Fatalf("expected an EIP-1559 transaction, got type %d", tx.Type())
+	}
+	if tx.GasTipCap().Cmp(tip) != 0 {
+		t.Fatalf("expected tip %s, got %s", tip, tx.GasTipCap())
+	}
+	feeCap := new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tip)
+	if tx.GasFeeCap().Cmp(feeCap) != 0 {
+		t.Fatalf("expected fee cap %s, got %s", feeCap, tx.GasFeeCap())
+	}
+	if tx.Gas() != 21000 {
+		t.Fatalf("expected the estimated gas limit 21000, got %d", tx.Gas())
+	}
+	if tx.Nonce() != 0 {
+		t.Fatalf("expected the pending nonce 0, got %d", tx.Nonce())
+	}
+
+	sim.Commit()
+	receipt, err := sim.TransactionReceipt(ctx, tx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatal("expected the transaction to succeed")
+	}
+	balance, err := sim.BalanceAt(ctx, common.HexToAddress(testRecipient), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Fatalf("expected a balance of 1000, got %s", balance)
+	}
+}
+
+func TestSendTxPrefersFeeHistory(t *testing.T) {
+	b, s := getTestBackend(t)
+	sim := newSimulatedChain(t, b, s, "test")
+	b.newClient = func(ctx context.Context, rpcURL string) (ethClient, error) {
+		return feeHistoryClient{simClient{sim}, big.NewInt(2000000000), big.NewInt(3)}, nil
+	}
+
+	tx := sentTransaction(t, sendTx(t, b, s, nil))
+	if tx.GasTipCap().Cmp(big.NewInt(3)) != 0 {
+		t.Fatalf("expected tip 3, got %s", tx.GasTipCap())
+	}
+	if tx.GasFeeCap().Cmp(big.NewInt(4000000003)) != 0 {
+		t.Fatalf("expected fee cap 4000000003, got %s", tx.GasFeeCap())
+	}
+}
+
+func TestSendTxFillsLegacyGasPrice(t *testing.T) {
+	b, s := getTestBackend(t)
+	sim := newSimulatedChain(t, b, s, "test")
+	b.newClient = func(ctx context.Context, rpcURL string) (ethClient, error) {
+		return pricedClient{simClient{sim}, big.NewInt(2000000000)}, nil
+	}
+
+	tx := sentTransaction(t, sendTx(t, b, s, map[string]interface{}{"tx_type": TxTypeLegacy}))
+	if tx.Type() != types.LegacyTxType {
+		t.Fatalf("expected a legacy transaction, got type %d", tx.Type())
+	}
+	if tx.GasPrice().Cmp(big.NewInt(2000000000)) != 0 {
+		t.Fatalf("expected gas price 2000000000, got %s", tx.GasPrice())
+	}
+
+	sim.Commit()
+	receipt, err := sim.TransactionReceipt(context.Background(), tx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatal("expected the transaction to succeed")
+	}
+}
+
+func TestSendTxKeepsCallerFees(t *testing.T) {
+	b, s := getTestBackend(t)
+	newSimulatedChain(t, b, s, "test")
+
+	tx := sentTransaction(t, sendTx(t, b, s, map[string]interface{}{
+		"max_priority_fee_per_gas": "5",
+		"max_fee_per_gas":          "5000000000",
+		"gas_limit":                "30000",
+	}))
+	if tx.GasTipCap().Cmp(big.NewInt(5)) != 0 || tx.GasFeeCap().Cmp(big.NewInt(5000000000)) != 0 {
+		t.Fatalf("expected the given fees, got tip %s and fee cap %s", tx.GasTipCap(), tx.GasFeeCap())
+	}
+	if tx.Gas() != 30000 {
+		t.Fatalf("expected the given gas limit, got %d", tx.Gas())
+	}
+}
+
+func TestSendTxAllocatesManagedNonces(t *testing.T) {
+	b, s := getTestBackend(t)
+	sim := newSimulatedChain(t, b, s, "test")
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/nonces/1337", map[string]interface{}{
+		"next": 0,
+	}))
+
+	for want := uint64(0); want < 3; want++ {
+		tx := sentTransaction(t, sendTx(t, b, s, nil))
+		if tx.Nonce() != want {
+			t.Fatalf("expected nonce %d, got %d", want, tx.Nonce())
+		}
+	}
+	sim.Commit()
+	nonce, err := sim.NonceAt(context.Background(), common.HexToAddress(testAddress), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce != 3 {
+		t.Fatalf("expected 3 transactions to be mined, got %d", nonce)
+	}
+
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/test/nonces/1337", nil))
+	if resp.Data["next"] != uint64(3) {
+		t.Fatalf("expected the counter at 3, got %v", resp.Data["next"])
+	}
+}
+
+func TestSendTxReleasesNonceOnBroadcastFailure(t *testing.T) {
+	b, s := getTestBackend(t)
+	sim := newSimulatedChain(t, b, s, "test")
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/nonces/1337", map[string]interface{}{
+		"next": 0,
+	}))
+
+	b.newClient = func(ctx context.Context, rpcURL string) (ethClient, error) {
+		return failingClient{simClient{sim}}, nil
+	}
+	mustFail(t, sendTx(t, b, s, nil))
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/test/nonces/1337", nil))
+	dropped := resp.Data["dropped"].([]uint64)
+	if len(dropped) != 1 || dropped[0] != 0 {
+		t.Fatalf("expected nonce 0 to be released, got %v", dropped)
+	}
+
+	b.newClient = func(ctx context.Context, rpcURL string) (ethClient, error) {
+		return simClient{sim}, nil
+	}
+	tx := sentTransaction(t, sendTx(t, b, s, nil))
+	if tx.Nonce() != 0 {
+		t.Fatalf("expected the released nonce 0 to be reused, got %d", tx.Nonce())
+	}
+}
+
+func TestSendTxReleasesSpendingOnBroadcastFailure(t *testing.T) {
+	b, s := getTestBackend(t)
+	sim := newSimulatedChain(t, b, s, "test")
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", map[string]interface{}{
+		"spending_limits": map[string]interface{}{"24h": "1500"},
+	}))
+
+	b.newClient = func(ctx context.Context, rpcURL string) (ethClient, error) {
+		return failingClient{simClient{sim}}, nil
+	}
+	mustFail(t, sendTx(t, b, s, nil))
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/test/spending", nil))
+	if usage := resp.Data["usage"].(map[string]interface{}); len(usage) != 0 {
+		t.Fatalf("expected the failed transaction not to count, got %v", usage)
+	}
+
+	b.newClient = func(ctx context.Context, rpcURL string) (ethClient, error) {
+		return simClient{sim}, nil
+	}
+	sentTransaction(t, sendTx(t, b, s, nil))
+	if rule := violatedRule(t, sendTx(t, b, s, nil)); rule != RuleSpendingLimit {
+		t.Fatalf("expected rule %s to be violated, got %s", RuleSpendingLimit, rule)
+	}
+}
+
+func TestSendTxUsesPendingNonceWithoutCounter(t *testing.T) {
+	b, s := getTestBackend(t)
+	newSimulatedChain(t, b, s, "test")
+
+	for want := uint64(0); want < 2; want++ {
+		tx := sentTransaction(t, sendTx(t, b, s, nil))
+		if tx.Nonce() != want {
+			t.Fatalf("expected the pending nonce %d, got %d", want, tx.Nonce())
+		}
+	}
+	if resp := request(t, b, s, logical.ReadOperation, "accounts/test/nonces/1337", nil); resp != nil && !resp.IsError() {
+		t.Fatalf("expected no nonce counter, got %v", resp.Data)
+	}
+}
+
+func TestSendTxRejectsLegacyAccessList(t *testing.T) {
+	b, s := getTestBackend(t)
+	newSimulatedChain(t, b, s, "test")
+
+	resp := mustFail(t, sendTx(t, b, s, map[string]interface{}{
+		"tx_type":     TxTypeLegacy,
+		"access_list": testAccessList,
+	}))
+	if !strings.Contains(resp.Error().Error(), "access_list") {
+		t.Fatalf("expected the access list to be rejected, got %v", resp.Error())
+	}
+
+	tx := sentTransaction(t, sendTx(t, b, s, map[string]interface{}{"access_list": testAccessList}))
+	if tx.Type() != types.DynamicFeeTxType || len(tx.AccessList()) != 1 {
+		t.Fatalf("expected an EIP-1559 transaction with an access list, got %+v", tx)
+	}
+}
+
+func TestSendTxRequiresRPCURL(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "config/chains/offline", map[string]interface{}{
+		"chain_id": 5,
+	}))
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test/send-tx", map[string]interface{}{
+		"chain": "offline",
+		"to":    testRecipient,
+	}))
+}
+
+func TestSendTxByAddressAndWalletAccount(t *testing.T) {
+	b, s := getTestBackend(t)
+	sim := newSimulatedChain(t, b, s, "test")
+	fields := map[string]interface{}{
+		"chain": "sim",
+		"to":    testRecipient,
+		"value": "1000",
+	}
+
+	tx := sentTransaction(t, request(t, b, s, logical.UpdateOperation, "addresses/"+testAddress+"/send-tx", fields))
+	if tx.Nonce() != 0 {
+		t.Fatalf("expected nonce 0, got %d", tx.Nonce())
+	}
+	sim.Commit()
+
+	// the first account of the wallet holds the key of the account test
+	request(t, b, s, logical.DeleteOperation, "accounts/test", nil)
+	createTestWallet(t, b, s)
+	tx = sentTransaction(t, request(t, b, s, logical.UpdateOperation, "wallets/w/accounts/0/send-tx", fields))
+	if tx.Nonce() != 1 {
+		t.Fatalf("expected nonce 1, got %d", tx.Nonce())
+	}
+}
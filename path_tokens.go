@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// TokenConfig describes an ERC-20 token this mount may transfer
+type TokenConfig struct {
+	Address  string `json:"address"`
+	Decimals uint8  `json:"decimals"`
+	Symbol   string `json:"symbol,omitempty"`
+}
+
+func tokenPaths(b *vaultEthereumBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("config/tokens/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathTokensList,
+			},
+			HelpSynopsis: "List the ERC-20 tokens registered on this mount",
+			HelpDescription: `
+			All the registered tokens will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("config/tokens/" + framework.GenericNameRegex("token")),
+			HelpSynopsis: "Register an ERC-20 token.",
+			HelpDescription: `
+
+Registers the contract address and the decimals of an ERC-20 token by name.
+sign-erc20-transfer and the max_token_amounts policy rule take human readable
+amounts that are converted with the decimals of the token.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"token": {Type: framework.TypeString},
+				"address": {
+					Type:        framework.TypeString,
+					Description: "The address of the token contract.",
+				},
+				"decimals": {
+					Type:        framework.TypeInt,
+					Description: "The number of decimals of the token.",
+					Default:     18,
+				},
+				"symbol": {
+					Type:        framework.TypeString,
+					Description: "The symbol of the token.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathTokenRead,
+				logical.CreateOperation: b.pathTokenWrite,
+				logical.UpdateOperation: b.pathTokenWrite,
+				logical.DeleteOperation: b.pathTokenDelete,
+			},
+		},
+	}
+}
+
+func tokenPath(name string) string {
+	return QualifiedPath(fmt.Sprintf("config/tokens/%s", name))
+}
+
+func readToken(ctx context.Context, s logical.Storage, name string) (*TokenConfig, error) {
+	entry, err := s.Get(ctx, tokenPath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var token TokenConfig
+	if err := entry.DecodeJSON(&token); err != nil {
+		return nil, fmt.Errorf("failed to deserialize token %s: %v", name, err)
+	}
+	return &token, nil
+}
+
+// resolveToken finds a registered token by name or by contract address
+func resolveToken(ctx context.Context, s logical.Storage, nameOrAddress string) (*TokenConfig, error) {
+	if !common.IsHexAddress(nameOrAddress) {
+		return readToken(ctx, s, nameOrAddress)
+	}
+
+	address := common.HexToAddress(nameOrAddress).Hex()
+	names, err := s.List(ctx, QualifiedPath("config/tokens/"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		token, err := readToken(ctx, s, name)
+		if err != nil {
+			return nil, err
+		}
+		if token != nil && token.Address == address {
+			return token, nil
+		}
+	}
+	return nil, nil
+}
+
+func (b *vaultEthereumBackend) pathTokensList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, QualifiedPath("config/tokens/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *vaultEthereumBackend) pathTokenRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	token, err := readToken(ctx, req.Storage, data.Get("token").(string))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"address":  token.Address,
+			"decimals": token.Decimals,
+			"symbol":   token.Symbol,
+		},
+	}, nil
+}
+
+func (b *vaultEthereumBackend) pathTokenWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("token").(string)
+	token, err := readToken(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		token = &TokenConfig{Decimals: uint8(data.Get("decimals").(int))}
+	}
+
+	if address, ok := data.GetOk("address"); ok {
+		if !common.IsHexAddress(address.(string)) {
+			return logical.ErrorResponse("invalid address %s", address), nil
+		}
+		token.Address = common.HexToAddress(address.(string)).Hex()
+	}
+	if token.Address == Empty {
+		return logical.ErrorResponse("address not specified"), nil
+	}
+	if decimals, ok := data.GetOk("decimals"); ok {
+		if decimals.(int) < 0 || decimals.(int) > 255 {
+			return logical.ErrorResponse("invalid decimals"), nil
+		}
+		token.Decimals = uint8(decimals.(int))
+	}
+	if symbol, ok := data.GetOk("symbol"); ok {
+		token.Symbol = symbol.(string)
+	}
+
+	entry, err := logical.StorageEntryJSON(tokenPath(name), token)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	return b.pathTokenRead(ctx, req, data)
+}
+
+func (b *vaultEthereumBackend) pathTokenDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return nil, req.Storage.Delete(ctx, tokenPath(data.Get("token").(string)))
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bliiitz/vault-ethereum/util"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// MessageTypePersonal is an EIP-191 personal message
+	MessageTypePersonal string = "personal"
+	// MessageTypeTypedData is an EIP-712 typed data payload
+	MessageTypeTypedData string = "typed_data"
+	// MessageTypeHash is a raw 32-byte digest
+	MessageTypeHash string = "hash"
+)
+
+func verifyPaths(b *vaultEthereumBackend) []*framework.Path {
+	messageFields := map[string]*framework.FieldSchema{
+		"message": {
+			Type:        framework.TypeString,
+			Description: "An EIP-191 personal message, as signed by sign.",
+		},
+		"typed_data": {
+			Type:        framework.TypeString,
+			Description: "An EIP-712 payload (domain, types, primaryType and message) as JSON, as signed by sign-typed-data.",
+		},
+		"hash": {
+			Type:        framework.TypeString,
+			Description: "A raw 32-byte digest in hex.",
+		},
+		"signature": {
+			Type:        framework.TypeString,
+			Description: "The 65-byte signature in hex. The recovery id may be 0/1 or 27/28.",
+		},
+	}
+
+	verifyFields := map[string]*framework.FieldSchema{
+		"address": {
+			Type:        framework.TypeString,
+			Description: "The address the signature is expected to come from.",
+		},
+		"account": {
+			Type:        framework.TypeString,
+			Description: "The account the signature is expected to come from, or <wallet>/<index> for an account of a wallet.",
+		},
+	}
+	for name, field := range messageFields {
+		verifyFields[name] = field
+	}
+
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("recover"),
+			HelpSynopsis: "Recover the address that signed a message",
+			HelpDescription: `
+
+Recover the signer of exactly one of: an EIP-191 personal message, an EIP-712
+typed data payload or a raw 32-byte hash.
+
+`,
+			Fields:         messageFields,
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathRecover,
+				logical.UpdateOperation: b.pathRecover,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("verify"),
+			HelpSynopsis: "Verify that a message was signed by an address or an account",
+			HelpDescription: `
+
+Recover the signer of exactly one of: an EIP-191 personal message, an EIP-712
+typed data payload or a raw 32-byte hash, and compare it with either an
+address or the address of an account of this backend. Signatures made with
+a key the account was rotated away from are valid too.
+
+`,
+			Fields:         verifyFields,
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathVerify,
+				logical.UpdateOperation: b.pathVerify,
+			},
+		},
+	}
+}
+
+func (b *vaultEthereumBackend) pathRecover(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	digest, messageType, err := messageDigest(data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	signer, err := recoverSigner(digest, data.Get("signature").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"address": signer.Hex(),
+			"digest":  hexutil.Encode(digest),
+			"type":    messageType,
+		},
+	}, nil
+}
+
+func (b *vaultEthereumBackend) pathVerify(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	address := data.Get("address").(string)
+	name := data.Get("account").(string)
+
+	var expected common.Address
+	var previousKeys []*KeyVersion
+	switch {
+	case address != Empty && name != Empty:
+		return logical.ErrorResponse("address and account are mutually exclusive"), nil
+	case address != Empty:
+		if !common.IsHexAddress(address) {
+			return logical.ErrorResponse("invalid address %s", address), nil
+		}
+		expected = common.HexToAddress(address)
+	case name != Empty:
+		accountJSON, err := loadAccount(ctx, req, name)
+		if err != nil {
+			return nil, err
+		}
+		if accountJSON == nil {
+			return logical.ErrorResponse("account %s does not exist", name), nil
+		}
+		key, accountAddress, err := getAccountKey(*accountJSON)
+		if err != nil {
+			return nil, err
+		}
+		util.ZeroKey(key)
+		expected = accountAddress
+		previousKeys, err = readKeyVersions(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return logical.ErrorResponse("address or account not specified"), nil
+	}
+
+	digest, messageType, err := messageDigest(data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	signer, err := recoverSigner(digest, data.Get("signature").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"valid":    signer == expected,
+			"address":  signer.Hex(),
+			"expected": expected.Hex(),
+			"digest":   hexutil.Encode(digest),
+			"type":     messageType,
+		},
+	}
+	// Signatures made with a key the account rotated away from remain valid
+	for _, keyVersion := range previousKeys {
+		if signer == common.HexToAddress(keyVersion.Account.Address) {
+			resp.Data["valid"] = true
+			resp.Data["key_version"] = keyVersion.Version
+		}
+	}
+	return resp, nil
+}
+
+// messageDigest computes the digest of the single message field of a verify
+// or recover request, hashed the same way the sign endpoints hash it
+func messageDigest(data *framework.FieldData) ([]byte, string, error) {
+	var digest []byte
+	var messageType string
+	provided := 0
+
+	if message, ok := data.GetOk("message"); ok {
+		provided++
+		digest = accounts.TextHash([]byte(message.(string)))
+		messageType = MessageTypePersonal
+	}
+	if raw, ok := data.GetOk("typed_data"); ok {
+		provided++
+		typedData, err := parseTypedData(raw.(string))
+		if err != nil {
+			return nil, Empty, err
+		}
+		digest, _, _, err = hashTypedData(typedData)
+		if err != nil {
+			return nil, Empty, fmt.Errorf("failed to hash typed data: %v", err)
+		}
+		messageType = MessageTypeTypedData
+	}
+	if hash, ok := data.GetOk("hash"); ok {
+		provided++
+		decoded, err := hexutil.Decode(hash.(string))
+		if err != nil || len(decoded) != common.HashLength {
+			return nil, Empty, errors.New("hash must be 32 bytes in 0x-prefixed hex")
+		}
+		digest = decoded
+		messageType = MessageTypeHash
+	}
+
+	if provided != 1 {
+		return nil, Empty, errors.New("exactly one of message, typed_data or hash must be specified")
+	}
+	return digest, messageType, nil
+}
+
+// recoverSigner returns the address that produced signature over digest.
+// Signatures are accepted with either a 0/1 or a 27/28 recovery id.
+func recoverSigner(digest []byte, signature string) (common.Address, error) {
+	sig, err := hexutil.Decode(signature)
+	if err != nil || len(sig) != crypto.SignatureLength {
+		return common.Address{}, errors.New("signature must be 65 bytes in 0x-prefixed hex")
+	}
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+
+	publicKey, err := crypto.SigToPub(digest, sig)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid signature: %v", err)
+	}
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// cowAddress is the address of cowKey
+const cowAddress = "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"
+
+func TestVerifyPersonalMessage(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	for _, legacyV := range []bool{false, true} {
+		signature := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/sign", map[string]interface{}{
+			"message":  "hello",
+			"legacy_v": legacyV,
+		})).Data["signature"]
+
+		resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "verify", map[string]interface{}{
+			"account":   "test",
+			"message":   "hello",
+			"signature": signature,
+		}))
+		if resp.Data["valid"] != true || resp.Data["type"] != MessageTypePersonal {
+			t.Fatalf("legacy_v=%t: expected a valid personal signature, got %v", legacyV, resp.Data)
+		}
+
+		resp = mustSucceed(t, request(t, b, s, logical.UpdateOperation, "verify", map[string]interface{}{
+			"address":   cowAddress,
+			"message":   "hello",
+			"signature": signature,
+		}))
+		if resp.Data["valid"] != false || resp.Data["address"] != testAddress {
+			t.Fatalf("legacy_v=%t: expected the signature of %s not to match, got %v", legacyV, testAddress, resp.Data)
+		}
+	}
+}
+
+func TestRecoverTypedDataAndHash(t *testing.T) {
+	b, s := getTestBackend(t)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/cow", map[string]interface{}{
+		"private_key": hexutil.Encode(cowKey),
+	}))
+
+	signature := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/cow/sign-typed-data", map[string]interface{}{
+		"typed_data": mailTypedData,
+	})).Data["signature"]
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "recover", map[string]interface{}{
+		"typed_data": mailTypedData,
+		"signature":  signature,
+	}))
+	if resp.Data["address"] != cowAddress || resp.Data["digest"] != mailDigest {
+		t.Fatalf("expected %s to sign the Mail digest, got %v", cowAddress, resp.Data)
+	}
+
+	key, err := crypto.ToECDSA(cowKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := crypto.Sign(hexutil.MustDecode(mailDigest), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = mustSucceed(t, request(t, b, s, logical.UpdateOperation, "recover", map[string]interface{}{
+		"hash":      mailDigest,
+		"signature": hexutil.Encode(sig),
+	}))
+	if resp.Data["address"] != cowAddress || resp.Data["type"] != MessageTypeHash {
+		t.Fatalf("expected %s to sign the hash, got %v", cowAddress, resp.Data)
+	}
+}
+
+func TestVerifyRejectsInvalidRequests(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	validSignature := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/sign", map[string]interface{}{
+		"message": "hello",
+	})).Data["signature"]
+
+	for _, data := range []map[string]interface{}{
+		{"account": "test", "signature": validSignature},
+		{"account": "test", "message": "hello", "hash": mailDigest, "signature": validSignature},
+		{"account": "test", "hash": "0x1234", "signature": validSignature},
+		{"account": "test", "message": "hello", "signature": "0x1234"},
+		{"account": "test", "address": testAddress, "message": "hello", "signature": validSignature},
+		{"account": "missing", "message": "hello", "signature": validSignature},
+		{"address": "0x1234", "message": "hello", "signature": validSignature},
+		{"message": "hello", "signature": validSignature},
+	} {
+		mustFail(t, request(t, b, s, logical.UpdateOperation, "verify", data))
+	}
+}
@@ -0,0 +1,573 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bliiitz/vault-ethereum/util"
+	"github.com/ethereum/go-ethereum/common"
+	bip44 "github.com/miguelmota/go-ethereum-hdwallet"
+	"github.com/tyler-smith/go-bip39"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// DefaultWalletBasePath is the BIP-44 path the accounts of a wallet are derived under
+	DefaultWalletBasePath string = "m/44'/60'/0'/0"
+	// maxWalletListCount caps the number of addresses derived by a single listing
+	maxWalletListCount int = 1000
+)
+
+// WalletJSON is what we store for an HD wallet. Its accounts are derived on
+// demand at <base path>/<index> and never stored.
+type WalletJSON struct {
+	Mnemonic   string         `json:"mnemonic"`
+	Passphrase string         `json:"bip39_passphrase,omitempty"`
+	BasePath   string         `json:"base_path"`
+	Policy     *AccountPolicy `json:"policy,omitempty"`
+	// Disabled is set while the accounts of the wallet refuse to sign
+	Disabled *AccountDisabled `json:"disabled,omitempty"`
+}
+
+func walletPaths(b *vaultEthereumBackend) []*framework.Path {
+	wallet := "wallets/" + framework.GenericNameRegex("wallet")
+	walletIdentity := map[string]*framework.FieldSchema{
+		"wallet": {Type: framework.TypeString},
+	}
+	walletAccount := wallet + "/accounts/" + `(?P<index>\d+)`
+	identity := map[string]*framework.FieldSchema{
+		"wallet": {Type: framework.TypeString},
+		"index": {
+			Type:        framework.TypeInt,
+			Description: "The index of the account in the wallet.",
+		},
+	}
+
+	return framework.PathAppend([]*framework.Path{
+		{
+			Pattern: QualifiedPath("wallets/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathWalletsList,
+			},
+			HelpSynopsis: "List all the HD wallets",
+			HelpDescription: `
+			All the HD wallets will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("wallets/" + framework.GenericNameRegex("wallet")),
+			HelpSynopsis: "Create an HD wallet.",
+			HelpDescription: `
+
+Creates an HD wallet from a generated or provided mnemonic. Its accounts are
+derived on demand at wallets/<wallet>/accounts/<index>, which supports the
+same sign, send-tx, nonces and spending operations as accounts/<name>.
+Derived accounts are not stored: they are signed for under the policy of the
+wallet, managed at wallets/<wallet>/policy.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"wallet": {Type: framework.TypeString},
+				"mnemonic": {
+					Type:        framework.TypeString,
+					Default:     Empty,
+					Description: "The mnemonic of the wallet. If not provided, one is generated.",
+				},
+				"entropy_bits": {
+					Type:        framework.TypeInt,
+					Default:     DefaultEntropyBits,
+					Description: "The entropy of a generated mnemonic: 128 (12 words) to 256 (24 words), in steps of 32.",
+				},
+				"bip39_passphrase": {
+					Type:        framework.TypeString,
+					Default:     Empty,
+					Description: "An optional BIP-39 passphrase (the 25th word) combined with the mnemonic to derive the seed.",
+				},
+				"base_path": {
+					Type:        framework.TypeString,
+					Default:     DefaultWalletBasePath,
+					Description: "The BIP-32 path accounts are derived under, the index being appended to it.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathWalletRead,
+				logical.CreateOperation: b.pathWalletCreate,
+				logical.DeleteOperation: b.pathWalletDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("wallets/" + framework.GenericNameRegex("wallet") + "/accounts/?"),
+			HelpSynopsis: "List the addresses of a range of accounts of a wallet.",
+			HelpDescription: `
+
+Derives the accounts start to start+count-1 of the wallet. A write also
+records their addresses so they can be looked up with
+wallets/<wallet>/addresses/<address> and used through addresses/<address>.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"wallet": {Type: framework.TypeString},
+				"start": {
+					Type:        framework.TypeInt,
+					Description: "The first index to derive.",
+					Default:     0,
+				},
+				"count": {
+					Type:        framework.TypeInt,
+					Description: fmt.Sprintf("The number of accounts to derive, at most %d.", maxWalletListCount),
+					Default:     10,
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation:   b.pathWalletAccountsList,
+				logical.ReadOperation:   b.pathWalletAccountsList,
+				logical.UpdateOperation: b.pathWalletAccountsIndex,
+			},
+		},
+		{
+			Pattern:      QualifiedPath(walletAccount),
+			HelpSynopsis: "Read an account of a wallet.",
+			HelpDescription: `
+
+Derives the account at the given index of the wallet.
+
+`,
+			Fields: identity,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathWalletAccountRead,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("wallets/" + framework.GenericNameRegex("wallet") + "/addresses/" + framework.GenericNameRegex("address")),
+			HelpSynopsis: "Look up the index of an address of a wallet.",
+			HelpDescription: `
+
+Returns the index of an address recorded by a write to
+wallets/<wallet>/accounts.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"wallet":  {Type: framework.TypeString},
+				"address": {Type: framework.TypeString},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathWalletAddressRead,
+			},
+		},
+	},
+		policyPaths(b, wallet, walletIdentity),
+		disablePaths(b, wallet, walletIdentity),
+		signPaths(b, walletAccount, identity),
+		sendPaths(b, walletAccount, identity),
+		erc20Paths(b, walletAccount, identity),
+		noncePaths(b, walletAccount, identity),
+		spendingPaths(b, walletAccount, identity),
+	)
+}
+
+func walletPath(name string) string {
+	return QualifiedPath(fmt.Sprintf("wallets/%s", name))
+}
+
+// walletAddressPath is where the index of an address of a wallet is recorded
+func walletAddressPath(name string, address common.Address) string {
+	return QualifiedPath(fmt.Sprintf("wallet-addresses/%s/%s", name, address.Hex()))
+}
+
+// walletAccountName names the account derived at index of a wallet
+func walletAccountName(wallet string, index int) string {
+	return fmt.Sprintf("%s/%d", wallet, index)
+}
+
+// parseWalletAccountName splits a name built by walletAccountName
+func parseWalletAccountName(name string) (string, int, bool) {
+	separator := strings.LastIndex(name, "/")
+	if separator < 0 {
+		return Empty, 0, false
+	}
+	index, err := strconv.Atoi(name[separator+1:])
+	if err != nil {
+		return Empty, 0, false
+	}
+	return name[:separator], index, true
+}
+
+func readWallet(ctx context.Context, s logical.Storage, name string) (*WalletJSON, error) {
+	entry, err := s.Get(ctx, walletPath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var wallet WalletJSON
+	if err := entry.DecodeJSON(&wallet); err != nil {
+		return nil, fmt.Errorf("failed to deserialize wallet %s: %v", name, err)
+	}
+	return &wallet, nil
+}
+
+func writeWallet(ctx context.Context, s logical.Storage, name string, wallet *WalletJSON) error {
+	entry, err := logical.StorageEntryJSON(walletPath(name), wallet)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// readWalletAccount returns the account derived at index of a wallet, or nil
+// when the wallet does not exist or index is not a non-hardened index
+func readWalletAccount(ctx context.Context, s logical.Storage, name string, index int) (*AccountJSON, error) {
+	if index < 0 || index > math.MaxInt32 {
+		return nil, nil
+	}
+	wallet, err := readWallet(ctx, s, name)
+	if err != nil || wallet == nil {
+		return nil, err
+	}
+	return wallet.account(index), nil
+}
+
+// account returns the account derived at index, under the policy and the
+// disabled state of the wallet
+func (wallet *WalletJSON) account(index int) *AccountJSON {
+	return &AccountJSON{
+		Type:           AccountTypeHD,
+		Index:          index,
+		DerivationPath: wallet.derivationPath(index),
+		Mnemonic:       wallet.Mnemonic,
+		Passphrase:     wallet.Passphrase,
+		Policy:         wallet.Policy,
+		Disabled:       wallet.Disabled,
+	}
+}
+
+func (wallet *WalletJSON) derivationPath(index int) string {
+	return fmt.Sprintf("%s/%d", wallet.BasePath, index)
+}
+
+// addresses derives the addresses of count accounts from start, computing the
+// seed once
+func (wallet *WalletJSON) addresses(start int, count int) ([]common.Address, error) {
+	hdwallet, err := bip44.NewFromSeed(bip39.NewSeed(wallet.Mnemonic, wallet.Passphrase))
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]common.Address, count)
+	for i := range addresses {
+		path, err := bip44.ParseDerivationPath(wallet.derivationPath(start + i))
+		if err != nil {
+			return nil, err
+		}
+		account, err := hdwallet.Derive(path, false)
+		if err != nil {
+			return nil, err
+		}
+		addresses[i] = account.Address
+	}
+	return addresses, nil
+}
+
+func (b *vaultEthereumBackend) pathWalletsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, QualifiedPath("wallets/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *vaultEthereumBackend) pathWalletRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	wallet, err := readWallet(ctx, req.Storage, data.Get("wallet").(string))
+	if err != nil {
+		return nil, err
+	}
+	if wallet == nil {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"base_path":            wallet.BasePath,
+			"bip39_passphrase_set": wallet.Passphrase != Empty,
+			"disabled":             wallet.Disabled.data(),
+		},
+	}, nil
+}
+
+func (b *vaultEthereumBackend) pathWalletCreate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("wallet").(string)
+	mnemonic := data.Get("mnemonic").(string)
+
+	deleted, err := readDeletedWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if deleted != nil {
+		return logical.ErrorResponse("wallet %s was deleted; restore or purge deleted-wallets/%s first", name, name), nil
+	}
+
+	wallet := &WalletJSON{
+		Passphrase: data.Get("bip39_passphrase").(string),
+		BasePath:   strings.TrimSuffix(data.Get("base_path").(string), "/"),
+	}
+	if _, err := bip44.ParseDerivationPath(wallet.derivationPath(0)); err != nil {
+		return logical.ErrorResponse("invalid base_path: %v", err), nil
+	}
+
+	if mnemonic == Empty {
+		entropyBits := data.Get("entropy_bits").(int)
+		if !validEntropyBits(entropyBits) {
+			return logical.ErrorResponse("entropy_bits must be 128, 160, 192, 224 or 256"), nil
+		}
+		var err error
+		mnemonic, err = generateMnemonic(entropyBits)
+		if err != nil {
+			return nil, err
+		}
+	} else if _, ok := data.GetOk("entropy_bits"); ok {
+		return logical.ErrorResponse("entropy_bits cannot be combined with a mnemonic"), nil
+	} else if !bip39.IsMnemonicValid(mnemonic) {
+		return logical.ErrorResponse("mnemonic is invalid"), nil
+	}
+	wallet.Mnemonic = mnemonic
+
+	key, address, err := getAccountKey(*wallet.account(0))
+	if err != nil {
+		return nil, err
+	}
+	util.ZeroKey(key)
+
+	if err := writeWallet(ctx, req.Storage, name, wallet); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"base_path": wallet.BasePath,
+			"address":   address.Hex(),
+		},
+	}, nil
+}
+
+func (b *vaultEthereumBackend) pathWalletDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return nil, b.deleteWallet(ctx, req.Storage, data.Get("wallet").(string), req.DisplayName)
+}
+
+// recordedAddresses returns the index of each address of a wallet recorded by
+// a write to wallets/<wallet>/accounts
+func recordedAddresses(ctx context.Context, s logical.Storage, name string) (map[common.Address]int, error) {
+	prefix := QualifiedPath(fmt.Sprintf("wallet-addresses/%s/", name))
+	addresses, err := s.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	indexes := make(map[common.Address]int, len(addresses))
+	for _, address := range addresses {
+		entry, err := s.Get(ctx, prefix+address)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+		var index int
+		if err := entry.DecodeJSON(&index); err != nil {
+			return nil, err
+		}
+		indexes[common.HexToAddress(address)] = index
+	}
+	return indexes, nil
+}
+
+// unindexWallet removes the recorded addresses of a wallet from the address
+// index of the accounts
+func unindexWallet(ctx context.Context, s logical.Storage, name string) error {
+	indexes, err := recordedAddresses(ctx, s, name)
+	if err != nil {
+		return err
+	}
+	for address, index := range indexes {
+		if err := unindexAddress(ctx, s, address, walletAccountName(name, index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteWalletState removes the recorded addresses of a wallet along with the
+// nonce counters and the spending history of its accounts
+func (b *vaultEthereumBackend) deleteWalletState(ctx context.Context, s logical.Storage, name string) error {
+	if err := unindexWallet(ctx, s, name); err != nil {
+		return err
+	}
+	prefix := QualifiedPath(fmt.Sprintf("wallet-addresses/%s/", name))
+	addresses, err := s.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, address := range addresses {
+		if err := s.Delete(ctx, prefix+address); err != nil {
+			return err
+		}
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	indexes, err := s.List(ctx, QualifiedPath(fmt.Sprintf("wallet-nonces/%s/", name)))
+	if err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if err := deleteNonceCounters(ctx, s, name+"/"+strings.TrimSuffix(index, "/")); err != nil {
+			return err
+		}
+	}
+
+	prefix = QualifiedPath(fmt.Sprintf("wallet-spending/%s/", name))
+	indexes, err = s.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if err := s.Delete(ctx, prefix+index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walletRange derives the range of accounts requested on wallets/<wallet>/accounts
+func walletRange(ctx context.Context, req *logical.Request, data *framework.FieldData) (*WalletJSON, int, []common.Address, *logical.Response, error) {
+	name := data.Get("wallet").(string)
+	start := data.Get("start").(int)
+	count := data.Get("count").(int)
+	if start < 0 || count < 1 || count > maxWalletListCount || start+count-1 > math.MaxInt32 {
+		return nil, 0, nil, logical.ErrorResponse("start and count must select 1 to %d indexes between 0 and %d", maxWalletListCount, math.MaxInt32), nil
+	}
+
+	wallet, err := readWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+	if wallet == nil {
+		return nil, 0, nil, logical.ErrorResponse("wallet %s does not exist", name), nil
+	}
+	addresses, err := wallet.addresses(start, count)
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+	return wallet, start, addresses, nil, nil
+}
+
+func walletRangeResponse(start int, addresses []common.Address) *logical.Response {
+	keys := make([]string, len(addresses))
+	keyInfo := make(map[string]interface{}, len(addresses))
+	for i, address := range addresses {
+		keys[i] = strconv.Itoa(start + i)
+		keyInfo[keys[i]] = map[string]interface{}{
+			"address": address.Hex(),
+		}
+	}
+	return logical.ListResponseWithInfo(keys, keyInfo)
+}
+
+func (b *vaultEthereumBackend) pathWalletAccountsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, start, addresses, resp, err := walletRange(ctx, req, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	return walletRangeResponse(start, addresses), nil
+}
+
+func (b *vaultEthereumBackend) pathWalletAccountsIndex(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, start, addresses, resp, err := walletRange(ctx, req, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	name := data.Get("wallet").(string)
+	for i, address := range addresses {
+		if resp, err := addressConflict(ctx, req.Storage, address, walletAccountName(name, start+i)); resp != nil || err != nil {
+			return resp, err
+		}
+	}
+	for i, address := range addresses {
+		entry, err := logical.StorageEntryJSON(walletAddressPath(name, address), start+i)
+		if err != nil {
+			return nil, err
+		}
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+		if _, err := indexAddress(ctx, req.Storage, address, walletAccountName(name, start+i)); err != nil {
+			return nil, err
+		}
+	}
+	return walletRangeResponse(start, addresses), nil
+}
+
+func (b *vaultEthereumBackend) pathWalletAccountRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := walletAccountName(data.Get("wallet").(string), data.Get("index").(int))
+	accountJSON, err := loadAccount(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	if accountJSON == nil {
+		return nil, nil
+	}
+
+	key, address, err := getAccountKey(*accountJSON)
+	if err != nil {
+		return nil, err
+	}
+	util.ZeroKey(key)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"account":         name,
+			"address":         address.Hex(),
+			"derivation_path": accountJSON.derivationPath(),
+		},
+	}, nil
+}
+
+func (b *vaultEthereumBackend) pathWalletAddressRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("wallet").(string)
+	address := data.Get("address").(string)
+	if !common.IsHexAddress(address) {
+		return logical.ErrorResponse("invalid address %s", address), nil
+	}
+
+	entry, err := req.Storage.Get(ctx, walletAddressPath(name, common.HexToAddress(address)))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var index int
+	if err := entry.DecodeJSON(&index); err != nil {
+		return nil, err
+	}
+
+	wallet, err := readWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if wallet == nil {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"account":         walletAccountName(name, index),
+			"index":           index,
+			"address":         common.HexToAddress(address).Hex(),
+			"derivation_path": wallet.derivationPath(index),
+		},
+	}, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// createTestWallet creates the wallet w from testMnemonic, whose accounts 0
+// and 1 are testAddress and testRecipient
+func createTestWallet(t *testing.T, b *vaultEthereumBackend, s logical.Storage) {
+	t.Helper()
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "wallets/w", map[string]interface{}{
+		"mnemonic": testMnemonic,
+	}))
+	if resp.Data["address"] != testAddress {
+		t.Fatalf("expected address %s, got %v", testAddress, resp.Data["address"])
+	}
+}
+
+// transactionSigner recovers the address that signed tx
+func transactionSigner(t *testing.T, tx *types.Transaction) string {
+	t.Helper()
+	signer, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer.Hex()
+}
+
+func TestWalletAccounts(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestWallet(t, b, s)
+
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "wallets/w/accounts/1", nil))
+	if resp.Data["address"] != testRecipient || resp.Data["account"] != "w/1" || resp.Data["derivation_path"] != "m/44'/60'/0'/0/1" {
+		t.Fatalf("unexpected account %v", resp.Data)
+	}
+
+	resp = mustSucceed(t, request(t, b, s, logical.ListOperation, "wallets/w/accounts/", map[string]interface{}{
+		"start": 0,
+		"count": 2,
+	}))
+	info := resp.Data["key_info"].(map[string]interface{})
+	if info["1"].(map[string]interface{})["address"] != testRecipient || len(info) != 2 {
+		t.Fatalf("unexpected accounts %v", info)
+	}
+	mustFail(t, request(t, b, s, logical.ListOperation, "wallets/w/accounts/", map[string]interface{}{"count": 1001}))
+
+	if resp := request(t, b, s, logical.ReadOperation, "wallets/w/addresses/"+testRecipient, nil); resp != nil {
+		t.Fatalf("expected the address not to be indexed yet, got %v", resp.Data)
+	}
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "wallets/w/accounts", map[string]interface{}{
+		"start": 0,
+		"count": 2,
+	}))
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "wallets/w/addresses/"+testRecipient, nil))
+	if resp.Data["index"] != 1 || resp.Data["account"] != "w/1" {
+		t.Fatalf("unexpected lookup %v", resp.Data)
+	}
+
+	tx := signedTransaction(t, signTxAt(t, b, s, "wallets/w/accounts/1", "1", nil))
+	if signer := transactionSigner(t, tx); signer != testRecipient {
+		t.Fatalf("expected the transaction to be signed by %s, got %s", testRecipient, signer)
+	}
+}
+
+func TestWalletCreateRejectsInvalidInput(t *testing.T) {
+	b, s := getTestBackend(t)
+	for _, data := range []map[string]interface{}{
+		{"mnemonic": "not a mnemonic"},
+		{"mnemonic": testMnemonic, "entropy_bits": 256},
+		{"entropy_bits": 100},
+		{"base_path": "m/44'/60'/x"},
+	} {
+		mustFail(t, request(t, b, s, logical.UpdateOperation, "wallets/w", data))
+	}
+}
+
+func TestWalletPolicy(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestWallet(t, b, s)
+	createTestAccount(t, b, s, "test")
+
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "wallets/w/policy", map[string]interface{}{
+		"max_value":       "1000",
+		"spending_limits": "24h=1500",
+	}))
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "wallets/w/policy", nil))
+	if resp.Data["max_value"] != "1000" {
+		t.Fatalf("unexpected policy %v", resp.Data)
+	}
+
+	if rule := violatedRule(t, signTxAt(t, b, s, "wallets/w/accounts/0", "1001", nil)); rule != RuleMaxValue {
+		t.Fatalf("expected rule %s, got %s", RuleMaxValue, rule)
+	}
+	// the account holding the same key is not bound by the policy of the wallet
+	mustSucceed(t, signTx(t, b, s, "test", "1001", nil))
+
+	// spending limits are tracked per account
+	mustSucceed(t, signTxAt(t, b, s, "wallets/w/accounts/0", "1000", nil))
+	if rule := violatedRule(t, signTxAt(t, b, s, "wallets/w/accounts/0", "1000", nil)); rule != RuleSpendingLimit {
+		t.Fatalf("expected rule %s, got %s", RuleSpendingLimit, rule)
+	}
+	mustSucceed(t, signTxAt(t, b, s, "wallets/w/accounts/1", "1000", nil))
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "wallets/w/accounts/0/spending", nil))
+	if usage := resp.Data["usage"].(map[string]interface{})["1"].([]WindowUsage); usage[0].Spent != "1000" {
+		t.Fatalf("unexpected usage %v", usage)
+	}
+
+	request(t, b, s, logical.DeleteOperation, "wallets/w/policy", nil)
+	mustSucceed(t, signTxAt(t, b, s, "wallets/w/accounts/0", "1001", nil))
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "wallets/missing/policy", map[string]interface{}{"max_value": "1"}))
+}
+
+// The nonces of the accounts of a wallet are not shared with an account named
+// like the wallet
+func TestWalletNonces(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestWallet(t, b, s)
+	createTestAccount(t, b, s, "w")
+
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "wallets/w/accounts/3/nonces/1", map[string]interface{}{
+		"next": 5,
+	}))
+	tx := signedTransaction(t, signTxAt(t, b, s, "wallets/w/accounts/3", "1", map[string]interface{}{"nonce": nil}))
+	if tx.Nonce() != 5 {
+		t.Fatalf("expected nonce 5, got %d", tx.Nonce())
+	}
+	mustFail(t, signTx(t, b, s, "w", "1", map[string]interface{}{"nonce": nil}))
+
+	resp := mustSucceed(t, request(t, b, s, logical.ListOperation, "accounts/w/nonces/", nil))
+	if keys, _ := resp.Data["keys"].([]string); len(keys) != 0 {
+		t.Fatalf("expected account w to have no nonce counters, got %v", keys)
+	}
+	resp = mustSucceed(t, request(t, b, s, logical.ListOperation, "wallets/w/accounts/3/nonces/", nil))
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "1" {
+		t.Fatalf("expected a counter on chain 1, got %v", keys)
+	}
+}
+
+func TestWalletDelete(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestWallet(t, b, s)
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "wallets/w/accounts", map[string]interface{}{"count": 2}))
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "wallets/w/accounts/1/nonces/1", nil))
+
+	request(t, b, s, logical.DeleteOperation, "wallets/w", nil)
+	if resp := request(t, b, s, logical.ReadOperation, "wallets/w/accounts/1", nil); resp != nil {
+		t.Fatalf("expected the wallet to be deleted, got %v", resp.Data)
+	}
+	mustFail(t, signTxAt(t, b, s, "wallets/w/accounts/1", "1", nil))
+
+	request(t, b, s, logical.DeleteOperation, "deleted-wallets/w", nil)
+	ctx := context.Background()
+	for _, prefix := range []string{"wallet-addresses/w/", "wallet-nonces/w/", "wallet-spending/w/"} {
+		if keys, err := s.List(ctx, prefix); err != nil || len(keys) != 0 {
+			t.Fatalf("expected %s to be empty, got %v, %v", prefix, keys, err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// RuleAllowedTo restricts the recipients of a transaction
+	RuleAllowedTo string = "allowed_to"
+	// RuleAllowedChainIDs restricts the chains a transaction may target
+	RuleAllowedChainIDs string = "allowed_chain_ids"
+	// RuleMaxValue caps the value of a single transaction
+	RuleMaxValue string = "max_value"
+	// RuleMaxGasPrice caps the gas price of legacy transactions and the max fee per gas of EIP-1559 transactions
+	RuleMaxGasPrice string = "max_gas_price"
+	// RuleMaxGasLimit caps the gas limit of a transaction
+	RuleMaxGasLimit string = "max_gas_limit"
+)
+
+// AccountPolicy restricts the transactions an account is allowed to sign. An
+// empty rule does not restrict anything.
+type AccountPolicy struct {
+	AllowedTo       []string        `json:"allowed_to,omitempty"`
+	AllowedChainIDs []int64         `json:"allowed_chain_ids,omitempty"`
+	MaxValue        string          `json:"max_value,omitempty"`
+	MaxGasPrice     string          `json:"max_gas_price,omitempty"`
+	MaxGasLimit     uint64          `json:"max_gas_limit,omitempty"`
+	SpendingLimits  []SpendingLimit `json:"spending_limits,omitempty"`
+
+	// MaxTokenAmounts caps the ERC-20 amount of each transaction in base
+	// units, keyed by token address
+	MaxTokenAmounts map[string]string `json:"max_token_amounts,omitempty"`
+
+	AllowedCalls         []string `json:"allowed_calls,omitempty"`
+	DeniedCalls          []string `json:"denied_calls,omitempty"`
+	DenyUnknownSelectors bool     `json:"deny_unknown_selectors,omitempty"`
+
+	// Transactions above ApprovalThreshold (in wei) wait for RequiredApprovals
+	// distinct approvers before they are signed
+	ApprovalThreshold string        `json:"approval_threshold,omitempty"`
+	RequiredApprovals int           `json:"required_approvals,omitempty"`
+	Approvers         []string      `json:"approvers,omitempty"`
+	ApprovalTTL       time.Duration `json:"approval_ttl,omitempty"`
+
+	// TokenApprovalThresholds are the ERC-20 amounts in base units, keyed by
+	// token address, above which token transfers and approvals need approvals
+	TokenApprovalThresholds map[string]string `json:"token_approval_thresholds,omitempty"`
+}
+
+// PolicyViolation names the policy rule a transaction failed
+type PolicyViolation struct {
+	Rule   string
+	Reason string
+}
+
+func (v *PolicyViolation) Error() string {
+	return fmt.Sprintf("transaction rejected by policy rule %s: %s", v.Rule, v.Reason)
+}
+
+// Response renders the violation as a structured error response
+func (v *PolicyViolation) Response() *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"error": v.Error(),
+			"data": map[string]interface{}{
+				"rule":   v.Rule,
+				"reason": v.Reason,
+			},
+		},
+	}
+}
+
+// Evaluate checks a transaction bound for chainID against the policy and
+// returns the first rule it violates
+func (policy *AccountPolicy) Evaluate(chainID *big.Int, tx *types.Transaction) *PolicyViolation {
+	if policy == nil {
+		return nil
+	}
+
+	if len(policy.AllowedChainIDs) > 0 {
+		allowed := false
+		for _, id := range policy.AllowedChainIDs {
+			if chainID.Cmp(big.NewInt(id)) == 0 {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &PolicyViolation{RuleAllowedChainIDs, fmt.Sprintf("chain %s is not allowed", chainID)}
+		}
+	}
+
+	if len(policy.AllowedTo) > 0 {
+		if tx.To() == nil {
+			return &PolicyViolation{RuleAllowedTo, "contract creation is not allowed"}
+		}
+		if !containsAddress(policy.AllowedTo, *tx.To()) {
+			return &PolicyViolation{RuleAllowedTo, fmt.Sprintf("recipient %s is not allowed", tx.To().Hex())}
+		}
+	}
+
+	if policy.MaxValue != Empty {
+		maxValue, _ := new(big.Int).SetString(policy.MaxValue, 10)
+		if tx.Value().Cmp(maxValue) > 0 {
+			return &PolicyViolation{RuleMaxValue, fmt.Sprintf("value %s exceeds %s", tx.Value(), maxValue)}
+		}
+	}
+
+	if violation := policy.evaluateTokenAmount(tx); violation != nil {
+		return violation
+	}
+
+	if policy.MaxGasPrice != Empty {
+		maxGasPrice, _ := new(big.Int).SetString(policy.MaxGasPrice, 10)
+		if tx.GasFeeCap().Cmp(maxGasPrice) > 0 {
+			return &PolicyViolation{RuleMaxGasPrice, fmt.Sprintf("gas price %s exceeds %s", tx.GasFeeCap(), maxGasPrice)}
+		}
+	}
+
+	if policy.MaxGasLimit > 0 && tx.Gas() > policy.MaxGasLimit {
+		return &PolicyViolation{RuleMaxGasLimit, fmt.Sprintf("gas limit %d exceeds %d", tx.Gas(), policy.MaxGasLimit)}
+	}
+
+	return nil
+}
+
+// containsAddress returns true if address is present in a list of hex addresses
+func containsAddress(addresses []string, address common.Address) bool {
+	for _, candidate := range addresses {
+		if common.HexToAddress(candidate) == address {
+			return true
+		}
+	}
+	return false
+}
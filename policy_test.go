@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestPolicyReadWrite(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", map[string]interface{}{
+		"allowed_to":        "0x70997970c51812dc3a010c7d01b50e0d17dc79c8",
+		"allowed_chain_ids": "1,5",
+		"max_value":         "1000",
+	}))
+	if !reflect.DeepEqual(resp.Data["allowed_to"], []string{testRecipient}) {
+		t.Fatalf("expected checksummed allowed_to, got %v", resp.Data["allowed_to"])
+	}
+	if !reflect.DeepEqual(resp.Data["allowed_chain_ids"], []int64{1, 5}) {
+		t.Fatalf("unexpected allowed_chain_ids %v", resp.Data["allowed_chain_ids"])
+	}
+
+	resp = mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", map[string]interface{}{
+		"max_gas_limit": 50000,
+	}))
+	if resp.Data["max_value"] != "1000" || resp.Data["max_gas_limit"] != uint64(50000) {
+		t.Fatalf("expected an update to keep the other rules, got %v", resp.Data)
+	}
+
+	request(t, b, s, logical.DeleteOperation, "accounts/test/policy", nil)
+	resp = mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/test/policy", nil))
+	if resp.Data["max_value"] != "" || len(resp.Data["allowed_to"].([]string)) != 0 {
+		t.Fatalf("expected an empty policy, got %v", resp.Data)
+	}
+}
+
+func TestPolicyRejectsInvalidRules(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	for _, data := range []map[string]interface{}{
+		{"allowed_to": "not-an-address"},
+		{"max_value": "-1"},
+		{"max_gas_price": "one"},
+		{"max_gas_limit": -1},
+	} {
+		mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", data))
+	}
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/missing/policy", map[string]interface{}{
+		"max_value": "1",
+	}))
+}
+
+func TestPolicyEnforcedOnSignTx(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", map[string]interface{}{
+		"allowed_to":        testRecipient,
+		"allowed_chain_ids": "1",
+		"max_value":         "1000",
+		"max_gas_price":     "2000000000",
+		"max_gas_limit":     21000,
+	}))
+
+	mustSucceed(t, signTx(t, b, s, "test", "1000", nil))
+	for rule, data := range map[string]map[string]interface{}{
+		RuleAllowedTo:       {"to": testAddress},
+		RuleAllowedChainIDs: {"chain_id": 5},
+		RuleMaxValue:        {"value": "1001"},
+		RuleMaxGasPrice:     {"gas_price": "2000000001"},
+		RuleMaxGasLimit:     {"gas_limit": "21001"},
+	} {
+		if got := violatedRule(t, signTx(t, b, s, "test", "1", data)); got != rule {
+			t.Fatalf("expected rule %s to be violated, got %s", rule, got)
+		}
+	}
+}
+
+func TestPolicyEnforcedOnSign1559Tx(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", map[string]interface{}{
+		"max_gas_price": "2000000000",
+	}))
+
+	data := map[string]interface{}{
+		"chain_id":                 1,
+		"to":                       testRecipient,
+		"value":                    "1",
+		"nonce":                    0,
+		"gas_limit":                "21000",
+		"max_priority_fee_per_gas": "1000000000",
+		"max_fee_per_gas":          "2000000000",
+	}
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/sign-1559-tx", data))
+	data["max_fee_per_gas"] = "3000000000"
+	if rule := violatedRule(t, request(t, b, s, logical.UpdateOperation, "accounts/test/sign-1559-tx", data)); rule != RuleMaxGasPrice {
+		t.Fatalf("expected rule %s to be violated, got %s", RuleMaxGasPrice, rule)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+
+	"github.com/bliiitz/vault-ethereum/util"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/hashicorp/vault/sdk/framework"
+)
+
+const (
+	// feeHistoryBlocks is the number of blocks sampled to suggest EIP-1559 fees
+	feeHistoryBlocks uint64 = 10
+	// feeHistoryPercentile is the priority fee percentile sampled in each block
+	feeHistoryPercentile float64 = 50
+)
+
+// ethClient is the subset of the Ethereum JSON-RPC API used to fill in and
+// broadcast transactions. It is satisfied by *ethclient.Client as well as the
+// simulated backend of go-ethereum.
+type ethClient interface {
+	bind.ContractBackend
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+}
+
+// feeHistoryReader is implemented by clients that support eth_feeHistory
+type feeHistoryReader interface {
+	FeeHistory(ctx context.Context, blocks uint64, percentile float64) (baseFee *big.Int, tip *big.Int, err error)
+}
+
+// rpcClient is an ethclient that also exposes eth_feeHistory
+type rpcClient struct {
+	*ethclient.Client
+	rpc *rpc.Client
+}
+
+// dialClient connects to a JSON-RPC endpoint
+func dialClient(ctx context.Context, rpcURL string) (ethClient, error) {
+	client, err := rpc.DialContext(ctx, rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	return &rpcClient{ethclient.NewClient(client), client}, nil
+}
+
+// closeClient releases the connection of a client
+func closeClient(client ethClient) {
+	switch c := client.(type) {
+	case interface{ Close() }:
+		c.Close()
+	case interface{ Close() error }:
+		c.Close()
+	}
+}
+
+// FeeHistory returns the base fee of the next block and the median priority
+// fee paid at the given percentile over the last blocks
+func (c *rpcClient) FeeHistory(ctx context.Context, blocks uint64, percentile float64) (*big.Int, *big.Int, error) {
+	var result struct {
+		BaseFee []*hexutil.Big   `json:"baseFeePerGas"`
+		Reward  [][]*hexutil.Big `json:"reward"`
+	}
+	if err := c.rpc.CallContext(ctx, &result, "eth_feeHistory", hexutil.Uint64(blocks), "latest", []float64{percentile}); err != nil {
+		return nil, nil, err
+	}
+	if len(result.BaseFee) == 0 {
+		return nil, nil, errors.New("empty fee history")
+	}
+
+	var rewards []*big.Int
+	for _, reward := range result.Reward {
+		if len(reward) > 0 && reward[0] != nil {
+			rewards = append(rewards, reward[0].ToInt())
+		}
+	}
+	tip := new(big.Int)
+	if len(rewards) > 0 {
+		sort.Slice(rewards, func(i, j int) bool { return rewards[i].Cmp(rewards[j]) < 0 })
+		tip = rewards[len(rewards)/2]
+	}
+	return result.BaseFee[len(result.BaseFee)-1].ToInt(), tip, nil
+}
+
+// suggestFees returns a priority fee and a fee cap that survives a doubling of
+// the base fee. eth_feeHistory is preferred when the client supports it.
+func suggestFees(ctx context.Context, client ethClient) (*big.Int, *big.Int, error) {
+	if reader, ok := client.(feeHistoryReader); ok {
+		baseFee, tip, err := reader.FeeHistory(ctx, feeHistoryBlocks, feeHistoryPercentile)
+		if err == nil {
+			return tip, new(big.Int).Add(new(big.Int).Mul(baseFee, big.NewInt(2)), tip), nil
+		}
+	}
+
+	tip, err := client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if head.BaseFee == nil {
+		return nil, nil, errors.New("chain does not support EIP-1559 transactions")
+	}
+	return tip, new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tip), nil
+}
+
+// fillTransactionData completes a sign request with the fees and the gas
+// limit suggested by the node when the caller did not provide them
+func fillTransactionData(ctx context.Context, client ethClient, data *framework.FieldData, from common.Address, txType string) error {
+	if txType == TxTypeLegacy {
+		if _, ok := data.GetOk("gas_price"); !ok {
+			gasPrice, err := client.SuggestGasPrice(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to suggest gas price: %v", err)
+			}
+			data.Raw["gas_price"] = gasPrice.String()
+		}
+	} else {
+		_, tipSet := data.GetOk("max_priority_fee_per_gas")
+		_, feeCapSet := data.GetOk("max_fee_per_gas")
+		if !tipSet || !feeCapSet {
+			tip, feeCap, err := suggestFees(ctx, client)
+			if err != nil {
+				return fmt.Errorf("failed to suggest fees: %v", err)
+			}
+			if !tipSet {
+				data.Raw["max_priority_fee_per_gas"] = tip.String()
+			}
+			if !feeCapSet {
+				data.Raw["max_fee_per_gas"] = feeCap.String()
+			}
+		}
+	}
+
+	if _, ok := data.GetOk("gas_limit"); !ok {
+		gasLimit, err := estimateGas(ctx, client, data, from)
+		if err != nil {
+			return err
+		}
+		data.Raw["gas_limit"] = strconv.FormatUint(gasLimit, 10)
+	}
+	return nil
+}
+
+// estimateGas estimates the gas used by the call or the contract deployment
+// made by a sign request. Deployments are estimated without a recipient.
+func estimateGas(ctx context.Context, client ethClient, data *framework.FieldData, from common.Address) (uint64, error) {
+	to, input, err := getTxInput(data)
+	if err != nil {
+		return 0, err
+	}
+
+	value := util.ValidNumber(data.Get("value").(string))
+	if value == nil {
+		return 0, errors.New("invalid value")
+	}
+
+	accessList, err := getAccessList(data)
+	if err != nil {
+		return 0, err
+	}
+
+	msg := ethereum.CallMsg{From: from, To: to, Value: value, Data: input, AccessList: accessList}
+	gasLimit, err := client.EstimateGas(ctx, msg)
+	if err != nil {
+		return 0, fmt.Errorf("failed to estimate gas: %v", err)
+	}
+	return gasLimit, nil
+}
+
+// estimateDeployment fills in the gas limit of a contract deployment from the
+// RPC endpoint of the chain, when one is configured and no limit was given
+func (b *vaultEthereumBackend) estimateDeployment(ctx context.Context, chain *ChainConfig, data *framework.FieldData, accountJSON *AccountJSON) error {
+	if _, deploy := data.GetOk("bytecode"); !deploy {
+		return nil
+	}
+	if _, ok := data.GetOk("gas_limit"); ok || chain == nil || chain.RPCURL == Empty {
+		return nil
+	}
+
+	key, from, err := getAccountKey(*accountJSON)
+	if err != nil {
+		return err
+	}
+	util.ZeroKey(key)
+
+	client, err := b.newClient(ctx, chain.RPCURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", chain.DisplayName, err)
+	}
+	defer closeClient(client)
+
+	gasLimit, err := estimateGas(ctx, client, data, from)
+	if err != nil {
+		return err
+	}
+	data.Raw["gas_limit"] = strconv.FormatUint(gasLimit, 10)
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/bliiitz/vault-ethereum/util"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// txBuilder builds the unsigned transaction of a sign request for chainID
+type txBuilder func(data *framework.FieldData, chainID *big.Int) (*types.Transaction, error)
+
+// signTxRequest handles the sign paths of an account, which only differ by
+// the type of transaction they build
+func (b *vaultEthereumBackend) signTxRequest(ctx context.Context, req *logical.Request, data *framework.FieldData, build txBuilder) (*logical.Response, error) {
+	name, accountJSON, resp, err := resolveSigner(ctx, req, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	chainID, chain, resp, err := resolveChain(ctx, req.Storage, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	call, err := encodeContractCall(ctx, req.Storage, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if err := b.estimateDeployment(ctx, chain, data, accountJSON); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	tx, err := build(data, chainID)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	_, nonceSet := data.GetOk("nonce")
+	signedTx, resp, err := b.signTransaction(ctx, req, name, accountJSON, chain, chainID, tx, nonceSet)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	resp, err = signedTxResponse(signedTx, chainID)
+	if err != nil {
+		return nil, err
+	}
+	if call != nil {
+		resp.Data["call"] = call
+	}
+	return resp, nil
+}
+
+// signTransaction runs tx through the gas caps of the chain, the account
+// policy, its spending limits and its nonce counter before signing it for
+// chainID. The chain is nil when no chain is registered for chainID. When
+// nonceSet is false the nonce is allocated from the nonce counter of the
+// account. A non nil response means the transaction was rejected or is
+// pending approval.
+func (b *vaultEthereumBackend) signTransaction(ctx context.Context, req *logical.Request, name string, accountJSON *AccountJSON, chain *ChainConfig, chainID *big.Int, tx *types.Transaction, nonceSet bool) (*types.Transaction, *logical.Response, error) {
+	violation, err := checkTransaction(ctx, req.Storage, accountJSON, chain, chainID, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if violation != nil {
+		return nil, violation.Response(), nil
+	}
+
+	if accountJSON.Policy.requiresApproval(tx) {
+		resp, err := b.createApprovalRequest(ctx, req, name, accountJSON.Policy, chainID, tx, nonceSet)
+		return nil, resp, err
+	}
+
+	return b.signChecked(ctx, req.Storage, name, accountJSON, chainID, tx, nonceSet)
+}
+
+// checkTransaction evaluates the rules that only depend on the transaction:
+// the gas caps of the chain and the account policy
+func checkTransaction(ctx context.Context, s logical.Storage, accountJSON *AccountJSON, chain *ChainConfig, chainID *big.Int, tx *types.Transaction) (*PolicyViolation, error) {
+	if violation := chain.Evaluate(tx.GasFeeCap(), tx.Gas()); violation != nil {
+		return violation, nil
+	}
+	if violation := accountJSON.Policy.Evaluate(chainID, tx); violation != nil {
+		return violation, nil
+	}
+	if accountJSON.Policy.hasCallRules() {
+		index, err := loadSelectorIndex(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		if violation := accountJSON.Policy.EvaluateCall(tx, index); violation != nil {
+			return violation, nil
+		}
+	}
+	return nil, nil
+}
+
+// signChecked signs a transaction that passed checkTransaction, enforcing the
+// spending limits and allocating the nonce
+func (b *vaultEthereumBackend) signChecked(ctx context.Context, s logical.Storage, name string, accountJSON *AccountJSON, chainID *big.Int, tx *types.Transaction, nonceSet bool) (*types.Transaction, *logical.Response, error) {
+	key, _, err := getAccountKey(*accountJSON)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer util.ZeroKey(key)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	spending, violation, err := b.checkSpending(ctx, s, name, accountJSON.Policy, chainID, tx.Value(), now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if violation != nil {
+		return nil, violation.Response(), nil
+	}
+
+	counter, err := readNonceCounter(ctx, s, name, chainID.Int64())
+	if err != nil {
+		return nil, nil, err
+	}
+	if !nonceSet {
+		if counter == nil {
+			return nil, logical.ErrorResponse("Nonce not specified and nonces are not managed for account %s on chain %s", name, chainID), nil
+		}
+		tx = withNonce(tx, counter.allocate())
+	} else if counter != nil {
+		counter.observe(tx.Nonce())
+	}
+
+	signedTx, err := types.SignTx(tx, types.LatestSignerForChainID(chainID), key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if counter != nil {
+		if err := writeNonceCounter(ctx, s, name, chainID.Int64(), counter); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := b.recordSpending(ctx, s, name, spending, chainID, signedTx.Hash(), tx.Value(), now); err != nil {
+		return nil, nil, err
+	}
+	if err := touchAccount(ctx, s, name); err != nil {
+		return nil, nil, err
+	}
+	return signedTx, nil, nil
+}
+
+// signedTxResponse renders a signed transaction, along with the address of the
+// contract it creates for deployments
+func signedTxResponse(signedTx *types.Transaction, chainID *big.Int) (*logical.Response, error) {
+	rawTx, err := encodeTransaction(signedTx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"chainId":           chainID,
+			"signedTransaction": signedTx,
+			"rlpSignature":      rawTx,
+		},
+	}
+	if signedTx.To() == nil {
+		address, err := contractAddress(signedTx, chainID)
+		if err != nil {
+			return nil, err
+		}
+		resp.Data["contract_address"] = address.Hex()
+	}
+	return resp, nil
+}
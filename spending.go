@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// RuleSpendingLimit caps the total value signed within a rolling window
+const RuleSpendingLimit string = "spending_limit"
+
+// SpendingLimit caps the total value signed on a chain within a rolling window
+type SpendingLimit struct {
+	Window time.Duration `json:"window"`
+	Amount string        `json:"amount"`
+}
+
+// SpendingRecord is the value of a signed transaction
+type SpendingRecord struct {
+	ChainID int64     `json:"chain_id"`
+	TxHash  string    `json:"tx_hash,omitempty"`
+	Time    time.Time `json:"time"`
+	Value   string    `json:"value"`
+}
+
+// SpendingHistory holds the transactions signed by an account that still fall
+// within its largest spending window
+type SpendingHistory struct {
+	Records []SpendingRecord `json:"records"`
+}
+
+// WindowUsage reports how much of a spending limit has been consumed
+type WindowUsage struct {
+	Window    string `json:"window"`
+	Limit     string `json:"limit"`
+	Spent     string `json:"spent"`
+	Remaining string `json:"remaining"`
+}
+
+// spendingPath is where the spending history of an account is stored. The
+// accounts of a wallet keep theirs apart, like their nonce counters.
+func spendingPath(name string) string {
+	if wallet, index, ok := parseWalletAccountName(name); ok {
+		return QualifiedPath(fmt.Sprintf("wallet-spending/%s/%d", wallet, index))
+	}
+	return QualifiedPath(fmt.Sprintf("spending/%s", name))
+}
+
+func readSpendingHistory(ctx context.Context, s logical.Storage, name string) (*SpendingHistory, error) {
+	entry, err := s.Get(ctx, spendingPath(name))
+	if err != nil {
+		return nil, err
+	}
+	var history SpendingHistory
+	if entry == nil {
+		return &history, nil
+	}
+	if err := entry.DecodeJSON(&history); err != nil {
+		return nil, fmt.Errorf("failed to deserialize spending history of %s: %v", name, err)
+	}
+	return &history, nil
+}
+
+func writeSpendingHistory(ctx context.Context, s logical.Storage, name string, history *SpendingHistory) error {
+	entry, err := logical.StorageEntryJSON(spendingPath(name), history)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// spent sums the value signed on chainID since the given time
+func (history *SpendingHistory) spent(chainID int64, since time.Time) *big.Int {
+	total := new(big.Int)
+	for _, record := range history.Records {
+		if record.ChainID != chainID || record.Time.Before(since) {
+			continue
+		}
+		value, ok := new(big.Int).SetString(record.Value, 10)
+		if ok {
+			total.Add(total, value)
+		}
+	}
+	return total
+}
+
+// prune drops the records that are older than every window
+func (history *SpendingHistory) prune(now time.Time, limits []SpendingLimit) {
+	var longest time.Duration
+	for _, limit := range limits {
+		if limit.Window > longest {
+			longest = limit.Window
+		}
+	}
+	cutoff := now.Add(-longest)
+	records := history.Records[:0]
+	for _, record := range history.Records {
+		if record.Time.After(cutoff) {
+			records = append(records, record)
+		}
+	}
+	history.Records = records
+}
+
+// chainIDs lists the chains the history holds records for
+func (history *SpendingHistory) chainIDs() []int64 {
+	seen := make(map[int64]bool)
+	var chainIDs []int64
+	for _, record := range history.Records {
+		if !seen[record.ChainID] {
+			seen[record.ChainID] = true
+			chainIDs = append(chainIDs, record.ChainID)
+		}
+	}
+	sort.Slice(chainIDs, func(i, j int) bool { return chainIDs[i] < chainIDs[j] })
+	return chainIDs
+}
+
+// usage reports the consumption of every limit on chainID
+func (history *SpendingHistory) usage(now time.Time, limits []SpendingLimit, chainID int64) []WindowUsage {
+	var usage []WindowUsage
+	for _, limit := range limits {
+		amount, _ := new(big.Int).SetString(limit.Amount, 10)
+		spent := history.spent(chainID, now.Add(-limit.Window))
+		remaining := new(big.Int).Sub(amount, spent)
+		if remaining.Sign() < 0 {
+			remaining.SetInt64(0)
+		}
+		usage = append(usage, WindowUsage{
+			Window:    limit.Window.String(),
+			Limit:     amount.String(),
+			Spent:     spent.String(),
+			Remaining: remaining.String(),
+		})
+	}
+	return usage
+}
+
+// checkSpending loads the spending history of the account and verifies that
+// signing value on chainID stays within every rolling window of the policy.
+// The history is nil when the policy has no spending limits. The caller must
+// hold b.lock until the transaction has been recorded.
+func (b *vaultEthereumBackend) checkSpending(ctx context.Context, s logical.Storage, name string, policy *AccountPolicy, chainID *big.Int, value *big.Int, now time.Time) (*SpendingHistory, *PolicyViolation, error) {
+	if policy == nil || len(policy.SpendingLimits) == 0 {
+		return nil, nil, nil
+	}
+
+	history, err := readSpendingHistory(ctx, s, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	history.prune(now, policy.SpendingLimits)
+
+	for _, limit := range policy.SpendingLimits {
+		amount, _ := new(big.Int).SetString(limit.Amount, 10)
+		spent := history.spent(chainID.Int64(), now.Add(-limit.Window))
+		if new(big.Int).Add(spent, value).Cmp(amount) > 0 {
+			remaining := new(big.Int).Sub(amount, spent)
+			if remaining.Sign() < 0 {
+				remaining.SetInt64(0)
+			}
+			return nil, &PolicyViolation{RuleSpendingLimit, fmt.Sprintf("value %s exceeds the remaining %s of %s per %s", value, remaining, amount, limit.Window)}, nil
+		}
+	}
+	return history, nil, nil
+}
+
+// recordSpending stores the value of a signed transaction in the history
+// returned by checkSpending
+func (b *vaultEthereumBackend) recordSpending(ctx context.Context, s logical.Storage, name string, history *SpendingHistory, chainID *big.Int, txHash common.Hash, value *big.Int, now time.Time) error {
+	if history == nil || value.Sign() == 0 {
+		return nil
+	}
+	history.Records = append(history.Records, SpendingRecord{
+		ChainID: chainID.Int64(),
+		TxHash:  txHash.Hex(),
+		Time:    now,
+		Value:   value.String(),
+	})
+	return writeSpendingHistory(ctx, s, name, history)
+}
+
+// releaseSpending removes the record of a signed transaction that could not
+// be broadcast, so its value no longer counts against the spending limits
+func (b *vaultEthereumBackend) releaseSpending(ctx context.Context, s logical.Storage, name string, txHash common.Hash) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	history, err := readSpendingHistory(ctx, s, name)
+	if err != nil {
+		return
+	}
+	records := history.Records[:0]
+	for _, record := range history.Records {
+		if record.TxHash != txHash.Hex() {
+			records = append(records, record)
+		}
+	}
+	if len(records) == len(history.Records) {
+		return
+	}
+	history.Records = records
+	if err := writeSpendingHistory(ctx, s, name, history); err != nil {
+		b.Logger().Warn("failed to release spending", "account", name, "tx_hash", txHash.Hex(), "error", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestSpendingLimit(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", map[string]interface{}{
+		"spending_limits": map[string]interface{}{"24h": "1000", "1h": "800"},
+	}))
+
+	mustSucceed(t, signTx(t, b, s, "test", "600", nil))
+	if rule := violatedRule(t, signTx(t, b, s, "test", "201", nil)); rule != RuleSpendingLimit {
+		t.Fatalf("expected rule %s to be violated, got %s", RuleSpendingLimit, rule)
+	}
+	mustSucceed(t, signTx(t, b, s, "test", "200", nil))
+	mustSucceed(t, signTx(t, b, s, "test", "800", map[string]interface{}{"chain_id": 5}))
+
+	resp := mustSucceed(t, request(t, b, s, logical.ReadOperation, "accounts/test/spending", map[string]interface{}{
+		"chain_id": 1,
+	}))
+	want := []WindowUsage{
+		{Window: "1h0m0s", Limit: "800", Spent: "800", Remaining: "0"},
+		{Window: "24h0m0s", Limit: "1000", Spent: "800", Remaining: "200"},
+	}
+	usage := resp.Data["usage"].(map[string]interface{})
+	if !reflect.DeepEqual(usage["1"], want) {
+		t.Fatalf("expected usage %v, got %v", want, usage["1"])
+	}
+	if _, ok := usage["5"]; ok {
+		t.Fatalf("expected only the usage of chain 1, got %v", usage)
+	}
+}
+
+func TestSpendingHistoryWindows(t *testing.T) {
+	now := time.Now()
+	limits := []SpendingLimit{{Window: time.Hour, Amount: "100"}}
+	history := &SpendingHistory{Records: []SpendingRecord{
+		{ChainID: 1, Time: now.Add(-2 * time.Hour), Value: "70"},
+		{ChainID: 1, Time: now.Add(-time.Minute), Value: "30"},
+		{ChainID: 5, Time: now.Add(-time.Minute), Value: "50"},
+	}}
+
+	if spent := history.spent(1, now.Add(-time.Hour)); spent.Int64() != 30 {
+		t.Fatalf("expected 30 spent within the window, got %s", spent)
+	}
+	history.prune(now, limits)
+	if len(history.Records) != 2 {
+		t.Fatalf("expected the expired record to be pruned, got %v", history.Records)
+	}
+	if chainIDs := history.chainIDs(); !reflect.DeepEqual(chainIDs, []int64{1, 5}) {
+		t.Fatalf("unexpected chain ids %v", chainIDs)
+	}
+}
+
+func TestSpendingLimitRejectsInvalidLimits(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	for _, limits := range []map[string]interface{}{
+		{"forever": "1"},
+		{"0s": "1"},
+		{"1h": ""},
+		{"1h": "-5"},
+	} {
+		mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test/policy", map[string]interface{}{
+			"spending_limits": limits,
+		}))
+	}
+}
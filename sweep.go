@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// erc20BalanceJSON declares the ERC-20 method reading a balance
+const erc20BalanceJSON = `[
+	{"type":"function","name":"balanceOf","inputs":[{"name":"owner","type":"address"}],"outputs":[{"type":"uint256"}]}
+]`
+
+var erc20BalanceABI = mustParseABI(erc20BalanceJSON)
+
+// sweepFees are the fees paid by the transactions sweeping an account, of the
+// transaction type of the chain
+type sweepFees struct {
+	chainID  *big.Int
+	txType   string
+	gasPrice *big.Int
+	tip      *big.Int
+	feeCap   *big.Int
+}
+
+// suggestSweepFees asks the node for the fees of a transaction of txType
+func suggestSweepFees(ctx context.Context, client ethClient, chainID *big.Int, txType string) (*sweepFees, error) {
+	fees := &sweepFees{chainID: chainID, txType: txType}
+	if txType == TxTypeLegacy {
+		gasPrice, err := client.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to suggest gas price: %v", err)
+		}
+		fees.gasPrice = gasPrice
+		return fees, nil
+	}
+	tip, feeCap, err := suggestFees(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest fees: %v", err)
+	}
+	fees.tip, fees.feeCap = tip, feeCap
+	return fees, nil
+}
+
+// maxFee is the most a transaction using gas may pay. Under EIP-1559 the part
+// of the fee cap that is not charged stays on the swept account.
+func (fees *sweepFees) maxFee(gas uint64) *big.Int {
+	price := fees.gasPrice
+	if fees.txType != TxTypeLegacy {
+		price = fees.feeCap
+	}
+	return new(big.Int).Mul(price, new(big.Int).SetUint64(gas))
+}
+
+// sign signs a sweep transaction with key
+func (fees *sweepFees) sign(key *ecdsa.PrivateKey, nonce uint64, to common.Address, value *big.Int, gas uint64, input []byte) (*types.Transaction, error) {
+	var txData types.TxData
+	if fees.txType == TxTypeLegacy {
+		txData = &types.LegacyTx{Nonce: nonce, To: &to, Value: value, Gas: gas, GasPrice: fees.gasPrice, Data: input}
+	} else {
+		txData = &types.DynamicFeeTx{ChainID: fees.chainID, Nonce: nonce, To: &to, Value: value, Gas: gas, GasTipCap: fees.tip, GasFeeCap: fees.feeCap, Data: input}
+	}
+	return types.SignNewTx(key, types.LatestSignerForChainID(fees.chainID), txData)
+}
+
+// sweepTransaction signs a transfer of the whole balance of key to a
+// recipient, less its fee and reserved, the fees of the sweeps signed before
+// it. The transaction is nil when the balance does not cover the fees.
+func sweepTransaction(ctx context.Context, client ethClient, key *ecdsa.PrivateKey, to common.Address, nonce uint64, fees *sweepFees, reserved *big.Int) (*types.Transaction, error) {
+	balance, err := client.BalanceAt(ctx, crypto.PubkeyToAddress(key.PublicKey), nil)
+	if err != nil {
+		return nil, err
+	}
+	value := new(big.Int).Sub(balance, reserved)
+	value.Sub(value, fees.maxFee(sweepGasLimit))
+	if value.Sign() <= 0 {
+		return nil, nil
+	}
+	return fees.sign(key, nonce, to, value, sweepGasLimit, nil)
+}
+
+// tokenSweepTransaction signs an ERC-20 transfer of the whole token balance
+// of key to a recipient. The transaction is nil when the balance is zero.
+func tokenSweepTransaction(ctx context.Context, client ethClient, key *ecdsa.PrivateKey, token common.Address, to common.Address, nonce uint64, fees *sweepFees) (*types.Transaction, error) {
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	input, err := erc20BalanceABI.Pack("balanceOf", from)
+	if err != nil {
+		return nil, err
+	}
+	output, err := client.CallContract(ctx, ethereum.CallMsg{From: from, To: &token, Data: input}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the balance of %s: %v", token.Hex(), err)
+	}
+	values, err := erc20BalanceABI.Unpack("balanceOf", output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the balance of %s: %v", token.Hex(), err)
+	}
+	balance := values[0].(*big.Int)
+	if balance.Sign() == 0 {
+		return nil, nil
+	}
+
+	input, err = erc20ABI.Pack("transfer", to, balance)
+	if err != nil {
+		return nil, err
+	}
+	gasLimit, err := client.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &token, Data: input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate the transfer of %s: %v", token.Hex(), err)
+	}
+	return fees.sign(key, nonce, token, new(big.Int), gasLimit, input)
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"math/big"
 	"strconv"
+	"strings"
 
 	"github.com/bliiitz/vault-ethereum/util"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/hashicorp/vault/sdk/framework"
 )
 
@@ -20,24 +25,16 @@ type TransactionParams struct {
 	GasLimit uint64          `json:"gas_limit"`
 }
 
-func getEIP1559TransactionData(data *framework.FieldData) (*types.Transaction, error) {
-	var err error
-	var to common.Address
+func getEIP1559TransactionData(data *framework.FieldData, chainID *big.Int) (*types.Transaction, error) {
 	var nonce uint64
 	var value *big.Int
 	var gasLimit uint64
-	var chainId int64
 	var feeCap *big.Int
 	var tip *big.Int
 
-	dataOrFile := data.Get("data").(string)
-
-	var txDataToSign []byte = []byte("")
-	if len(dataOrFile) > 0 {
-		txDataToSign, err = util.Decode([]byte(dataOrFile))
-		if err != nil {
-			return nil, err
-		}
+	to, txDataToSign, err := getTxInput(data)
+	if err != nil {
+		return nil, err
 	}
 
 	_, ok := data.GetOk("value")
@@ -54,83 +51,52 @@ func getEIP1559TransactionData(data *framework.FieldData) (*types.Transaction, e
 	if ok {
 		uintNonce := data.Get("nonce").(int64)
 		nonce = uint64(uintNonce)
-	} else {
-		return nil, errors.New("Nonce not specified")
 	}
 
-	_, ok = data.GetOk("gas_limit")
-	if ok {
-		uintGasLimit := data.Get("gas_limit").(string)
-		gasLimit, _ = strconv.ParseUint(uintGasLimit, 10, 64)
-	} else {
-		return nil, errors.New("Gas limit not specified")
+	gasLimit, err = getGasLimit(data)
+	if err != nil {
+		return nil, err
 	}
-	_, ok = data.GetOk("max_priority_fee_per_gas")
-	if ok {
-		uintTip := data.Get("max_priority_fee_per_gas").(string)
-		tip, _ = new(big.Int).SetString(uintTip, 10)
-	} else {
-		return nil, errors.New("Gas limit not specified")
+	tip, err = getFee(data, "max_priority_fee_per_gas")
+	if err != nil {
+		return nil, err
 	}
-	_, ok = data.GetOk("max_fee_per_gas")
-	if ok {
-		uintFeeCap := data.Get("max_fee_per_gas").(string)
-		feeCap, _ = new(big.Int).SetString(uintFeeCap, 10)
-	} else {
-		return nil, errors.New("Gas limit not specified")
+	feeCap, err = getFee(data, "max_fee_per_gas")
+	if err != nil {
+		return nil, err
 	}
 
-	_, ok = data.GetOk("to")
-	if ok {
-		to = common.HexToAddress(data.Get("to").(string))
-	} else {
-		return nil, errors.New("To address not specified")
+	accessList, err := getAccessList(data)
+	if err != nil {
+		return nil, err
 	}
 
-	bigChainID := new(big.Int).SetInt64(chainId)
 	tx := types.NewTx(&types.DynamicFeeTx{
-		ChainID:   bigChainID,
-		Nonce:     nonce,
-		GasFeeCap: feeCap,
-		GasTipCap: tip,
-		Gas:       gasLimit,
-		To:        &to,
-		Value:     value,
-		Data:      txDataToSign,
+		ChainID:    chainID,
+		Nonce:      nonce,
+		GasFeeCap:  feeCap,
+		GasTipCap:  tip,
+		Gas:        gasLimit,
+		To:         to,
+		Value:      value,
+		Data:       txDataToSign,
+		AccessList: accessList,
 	})
 
 	return tx, nil
 }
 
 func getTransactionData(data *framework.FieldData) (*types.Transaction, error) {
-	var err error
-	var to common.Address
 	var nonce uint64
 	var value *big.Int
 	var gasLimit uint64
-	var chainId int64
 	var gasPrice *big.Int
-	dataOrFile := data.Get("data").(string)
-
-	var txDataToSign []byte = []byte("")
-	if len(dataOrFile) > 0 {
-		txDataToSign, err = util.Decode([]byte(dataOrFile))
-		if err != nil {
-			return nil, err
-		}
+	to, txDataToSign, err := getTxInput(data)
+	if err != nil {
+		return nil, err
 	}
 
-	_, ok := data.GetOk("chain_id")
-	if ok {
-		chainId = data.Get("chain_id").(int64)
-		if chainId == 0 {
-			return nil, errors.New("invalid chain id")
-		}
-	} else {
-		return nil, errors.New("Chain ID not specified")
-	}
-
-	_, ok = data.GetOk("value")
+	_, ok := data.GetOk("value")
 	if ok {
 		value = util.ValidNumber(data.Get("value").(string))
 		if value == nil {
@@ -144,41 +110,200 @@ func getTransactionData(data *framework.FieldData) (*types.Transaction, error) {
 	if ok {
 		uintNonce := data.Get("nonce").(int64)
 		nonce = uint64(uintNonce)
-	} else {
-		return nil, errors.New("Nonce not specified")
 	}
 
-	_, ok = data.GetOk("gas_limit")
-	if ok {
-		uintGasLimit := data.Get("gas_limit").(string)
-		gasLimit, _ = strconv.ParseUint(uintGasLimit, 10, 64)
-	} else {
-		return nil, errors.New("Gas limit not specified")
+	gasLimit, err = getGasLimit(data)
+	if err != nil {
+		return nil, err
 	}
-
-	_, ok = data.GetOk("gas_price")
-	if ok {
-		uintGasPrice := data.Get("gas_price").(string)
-		gasPrice, _ = new(big.Int).SetString(uintGasPrice, 10)
-	} else {
-		return nil, errors.New("Gas price not specified")
-	}
-
-	_, ok = data.GetOk("to")
-	if ok {
-		to = common.HexToAddress(data.Get("to").(string))
-	} else {
-		return nil, errors.New("To address not specified")
+	gasPrice, err = getFee(data, "gas_price")
+	if err != nil {
+		return nil, err
 	}
 
 	tx := types.NewTx(&types.LegacyTx{
 		Nonce:    nonce,
 		Gas:      gasLimit,
 		GasPrice: gasPrice,
-		To:       &to,
+		To:       to,
 		Value:    value,
 		Data:     txDataToSign,
 	})
 
 	return tx, nil
 }
+
+func getEIP2930TransactionData(data *framework.FieldData, chainID *big.Int) (*types.Transaction, error) {
+	legacyTx, err := getTransactionData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	accessList, err := getAccessList(data)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := types.NewTx(&types.AccessListTx{
+		ChainID:    chainID,
+		Nonce:      legacyTx.Nonce(),
+		GasPrice:   legacyTx.GasPrice(),
+		Gas:        legacyTx.Gas(),
+		To:         legacyTx.To(),
+		Value:      legacyTx.Value(),
+		Data:       legacyTx.Data(),
+		AccessList: accessList,
+	})
+
+	return tx, nil
+}
+
+// getTxInput returns the recipient and the input of a transaction. When to is
+// omitted, the bytecode and the ABI-encoded constructor arguments make up a
+// contract creation.
+func getTxInput(data *framework.FieldData) (*common.Address, []byte, error) {
+	dataOrFile := data.Get("data").(string)
+	rawTo, toSet := data.GetOk("to")
+	bytecode, deploy := data.GetOk("bytecode")
+
+	if deploy {
+		if toSet {
+			return nil, nil, errors.New("to and bytecode are mutually exclusive")
+		}
+		if len(dataOrFile) > 0 {
+			return nil, nil, errors.New("data and bytecode are mutually exclusive")
+		}
+		input, err := decodeHex(bytecode.(string))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid bytecode: %v", err)
+		}
+		if len(input) == 0 {
+			return nil, nil, errors.New("bytecode is empty")
+		}
+		args, err := decodeHex(data.Get("constructor_args").(string))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid constructor_args: %v", err)
+		}
+		return nil, append(input, args...), nil
+	}
+
+	if !toSet {
+		return nil, nil, errors.New("To address not specified")
+	}
+	to := common.HexToAddress(rawTo.(string))
+
+	var txDataToSign []byte = []byte("")
+	if len(dataOrFile) > 0 {
+		var err error
+		txDataToSign, err = util.Decode([]byte(dataOrFile))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return &to, txDataToSign, nil
+}
+
+// decodeHex decodes a hex string with or without its 0x prefix
+func decodeHex(raw string) ([]byte, error) {
+	return util.Decode([]byte(strings.TrimPrefix(raw, "0x")))
+}
+
+// contractAddress returns the address of the contract created by a signed
+// deployment, derived from the sender and the nonce
+func contractAddress(tx *types.Transaction, chainID *big.Int) (common.Address, error) {
+	from, err := types.Sender(types.LatestSignerForChainID(chainID), tx)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.CreateAddress(from, tx.Nonce()), nil
+}
+
+// getGasLimit parses the gas_limit field, falling back to its default
+func getGasLimit(data *framework.FieldData) (uint64, error) {
+	raw := data.Get("gas_limit").(string)
+	if raw == Empty {
+		return 0, errors.New("Gas limit not specified")
+	}
+	gasLimit, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid gas_limit %s", raw)
+	}
+	return gasLimit, nil
+}
+
+// getFee parses a required fee field in wei
+func getFee(data *framework.FieldData, field string) (*big.Int, error) {
+	raw, ok := data.GetOk(field)
+	if !ok {
+		return nil, fmt.Errorf("%s not specified", field)
+	}
+	fee, ok := new(big.Int).SetString(raw.(string), 10)
+	if !ok || fee.Sign() < 0 {
+		return nil, fmt.Errorf("invalid %s %s", field, raw)
+	}
+	return fee, nil
+}
+
+// getAccessList parses the access_list field, a JSON list of
+// {"address": ..., "storageKeys": [...]} objects as used by eth_createAccessList
+func getAccessList(data *framework.FieldData) (types.AccessList, error) {
+	raw, ok := data.GetOk("access_list")
+	if !ok || raw.(string) == Empty {
+		return nil, nil
+	}
+
+	var accessList types.AccessList
+	if err := json.Unmarshal([]byte(raw.(string)), &accessList); err != nil {
+		return nil, fmt.Errorf("invalid access list: %v", err)
+	}
+	return accessList, nil
+}
+
+// withNonce returns a copy of an unsigned transaction using the given nonce
+func withNonce(tx *types.Transaction, nonce uint64) *types.Transaction {
+	to := tx.To()
+	switch tx.Type() {
+	case types.DynamicFeeTxType:
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    tx.ChainId(),
+			Nonce:      nonce,
+			GasFeeCap:  tx.GasFeeCap(),
+			GasTipCap:  tx.GasTipCap(),
+			Gas:        tx.Gas(),
+			To:         to,
+			Value:      tx.Value(),
+			Data:       tx.Data(),
+			AccessList: tx.AccessList(),
+		})
+	case types.AccessListTxType:
+		return types.NewTx(&types.AccessListTx{
+			ChainID:    tx.ChainId(),
+			Nonce:      nonce,
+			GasPrice:   tx.GasPrice(),
+			Gas:        tx.Gas(),
+			To:         to,
+			Value:      tx.Value(),
+			Data:       tx.Data(),
+			AccessList: tx.AccessList(),
+		})
+	default:
+		return types.NewTx(&types.LegacyTx{
+			Nonce:    nonce,
+			Gas:      tx.Gas(),
+			GasPrice: tx.GasPrice(),
+			To:       to,
+			Value:    tx.Value(),
+			Data:     tx.Data(),
+		})
+	}
+}
+
+// encodeTransaction returns the canonical encoding of a signed transaction as
+// expected by eth_sendRawTransaction
+func encodeTransaction(tx *types.Transaction) (string, error) {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return Empty, err
+	}
+	return hexutil.Encode(raw), nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const testAccessList = `[{"address": "0x70997970C51812dc3A010C7d01b50e0d17dc79C8", "storageKeys": ["0x0000000000000000000000000000000000000000000000000000000000000001"]}]`
+
+func TestSignAccessListTx(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	tx := signedTransaction(t, request(t, b, s, logical.UpdateOperation, "accounts/test/sign-2930-tx", map[string]interface{}{
+		"chain_id":    1,
+		"to":          testRecipient,
+		"nonce":       3,
+		"gas_price":   "1000000000",
+		"gas_limit":   "30000",
+		"access_list": testAccessList,
+	}))
+	if tx.Type() != types.AccessListTxType || tx.Nonce() != 3 || tx.GasPrice().Int64() != 1000000000 {
+		t.Fatalf("unexpected access list transaction %+v", tx)
+	}
+	accessList := tx.AccessList()
+	if len(accessList) != 1 || accessList[0].Address != common.HexToAddress(testRecipient) || len(accessList[0].StorageKeys) != 1 {
+		t.Fatalf("unexpected access list %v", accessList)
+	}
+	signer, err := types.Sender(types.NewEIP2930Signer(tx.ChainId()), tx)
+	if err != nil || signer.Hex() != testAddress {
+		t.Fatalf("expected a transaction signed by %s, got %s (%v)", testAddress, signer.Hex(), err)
+	}
+
+	tx = signedTransaction(t, request(t, b, s, logical.UpdateOperation, "accounts/test/sign-1559-tx", map[string]interface{}{
+		"chain_id":                 1,
+		"to":                       testRecipient,
+		"nonce":                    0,
+		"max_priority_fee_per_gas": "1",
+		"max_fee_per_gas":          "2",
+		"access_list":              testAccessList,
+	}))
+	if tx.Type() != types.DynamicFeeTxType || len(tx.AccessList()) != 1 {
+		t.Fatalf("expected an EIP-1559 transaction with an access list, got %+v", tx)
+	}
+	if tx.Gas() != 21000 {
+		t.Fatalf("expected the default gas limit 21000, got %d", tx.Gas())
+	}
+}
+
+func TestSignTxRejectsInvalidFields(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	for _, c := range []struct {
+		path string
+		data map[string]interface{}
+		err  string
+	}{
+		{"sign-tx", map[string]interface{}{"gas_price": nil}, "gas_price not specified"},
+		{"sign-tx", map[string]interface{}{"gas_price": "cheap"}, "invalid gas_price"},
+		{"sign-tx", map[string]interface{}{"gas_price": "-1"}, "invalid gas_price"},
+		{"sign-tx", map[string]interface{}{"gas_limit": "lots"}, "invalid gas_limit"},
+		{"sign-tx", map[string]interface{}{"gas_limit": ""}, "Gas limit not specified"},
+		{"sign-tx", map[string]interface{}{"data": "0xzz"}, ""},
+		{"sign-2930-tx", map[string]interface{}{"access_list": "[{"}, "invalid access list"},
+		{"sign-1559-tx", map[string]interface{}{"gas_price": nil, "max_fee_per_gas": "2"}, "max_priority_fee_per_gas not specified"},
+		{"sign-1559-tx", map[string]interface{}{"gas_price": nil, "max_priority_fee_per_gas": "1"}, "max_fee_per_gas not specified"},
+	} {
+		data := map[string]interface{}{
+			"chain_id":  1,
+			"to":        testRecipient,
+			"nonce":     0,
+			"gas_price": "1000000000",
+		}
+		for field, value := range c.data {
+			if value == nil {
+				delete(data, field)
+			} else {
+				data[field] = value
+			}
+		}
+		resp := mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test/"+c.path, data))
+		if !strings.Contains(resp.Error().Error(), c.err) {
+			t.Fatalf("%s %v: expected an error containing %q, got %v", c.path, c.data, c.err, resp.Error())
+		}
+	}
+}
+
+const (
+	// testInitCode deploys testRuntimeCode, a contract returning 42
+	testInitCode    = "0x600a600c600039600a6000f3602a60005260206000f3"
+	testRuntimeCode = "0x602a60005260206000f3"
+)
+
+func TestSignDeployment(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	resp := signTx(t, b, s, "test", "0", map[string]interface{}{
+		"to":               nil,
+		"nonce":            7,
+		"gas_limit":        "100000",
+		"bytecode":         testInitCode,
+		"constructor_args": "0x01",
+	})
+	tx := signedTransaction(t, resp)
+	if tx.To() != nil {
+		t.Fatalf("expected a contract creation, got a call to %s", tx.To().Hex())
+	}
+	if want := hexutil.MustDecode(testInitCode + "01"); !bytes.Equal(tx.Data(), want) {
+		t.Fatalf("expected the bytecode followed by the constructor arguments, got %x", tx.Data())
+	}
+	want := crypto.CreateAddress(common.HexToAddress(testAddress), 7).Hex()
+	if resp.Data["contract_address"] != want {
+		t.Fatalf("expected contract address %s, got %v", want, resp.Data["contract_address"])
+	}
+}
+
+func TestSignDeploymentRejectsInvalidInput(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	for _, data := range []map[string]interface{}{
+		{"bytecode": testInitCode},
+		{"to": nil, "bytecode": testInitCode, "data": "0x01"},
+		{"to": nil, "bytecode": "0x"},
+		{"to": nil, "bytecode": "0xzz"},
+		{"to": nil, "bytecode": testInitCode, "constructor_args": "0xzz"},
+		{"to": nil},
+	} {
+		mustFail(t, signTx(t, b, s, "test", "0", data))
+	}
+}
+
+func TestDeploymentEstimatesGas(t *testing.T) {
+	b, s := getTestBackend(t)
+	sim := newSimulatedChain(t, b, s, "test")
+
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/sign-tx", map[string]interface{}{
+		"chain":     "sim",
+		"nonce":     0,
+		"gas_price": "1000000000",
+		"bytecode":  testInitCode,
+	}))
+	if tx := signedTransaction(t, resp); tx.Gas() <= 21000 {
+		t.Fatalf("expected the deployment gas to be estimated, got %d", tx.Gas())
+	}
+
+	resp = sendTx(t, b, s, map[string]interface{}{
+		"to":       nil,
+		"value":    "0",
+		"bytecode": testInitCode,
+	})
+	sentTransaction(t, resp)
+	sim.Commit()
+	code, err := sim.CodeAt(context.Background(), common.HexToAddress(resp.Data["contract_address"].(string)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hexutil.Encode(code) != testRuntimeCode {
+		t.Fatalf("expected the contract to be deployed, got code %x", code)
+	}
+}
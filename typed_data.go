@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+// EIP712Domain is the reserved type name of the EIP-712 domain struct
+const EIP712Domain string = "EIP712Domain"
+
+// typedDataPayload is the wire format of an EIP-712 payload as produced by
+// eth_signTypedData_v4 and ethers' _TypedDataEncoder.getPayload
+type typedDataPayload struct {
+	Types       core.Types             `json:"types"`
+	PrimaryType string                 `json:"primaryType"`
+	Domain      map[string]interface{} `json:"domain"`
+	Message     map[string]interface{} `json:"message"`
+}
+
+// parseTypedData decodes an EIP-712 JSON payload. Numbers are kept as decimal
+// strings so uint256 values survive the round trip without losing precision.
+func parseTypedData(raw string) (*core.TypedData, error) {
+	if raw == Empty {
+		return nil, errors.New("typed data not specified")
+	}
+
+	var payload typedDataPayload
+	decoder := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("invalid typed data: %v", err)
+	}
+	if payload.PrimaryType == Empty {
+		return nil, errors.New("primaryType not specified")
+	}
+	if payload.Domain == nil {
+		return nil, errors.New("domain not specified")
+	}
+	if payload.Message == nil {
+		return nil, errors.New("message not specified")
+	}
+	if _, ok := payload.Types[payload.PrimaryType]; !ok {
+		return nil, fmt.Errorf("primaryType %s is not defined in types", payload.PrimaryType)
+	}
+
+	domain := normalizeTypedValue(payload.Domain).(map[string]interface{})
+	message := normalizeTypedValue(payload.Message).(map[string]interface{})
+
+	typedData := &core.TypedData{
+		Types:       payload.Types,
+		PrimaryType: payload.PrimaryType,
+		Message:     message,
+	}
+
+	for key, value := range domain {
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid domain field %s", key)
+		}
+		switch key {
+		case "name":
+			typedData.Domain.Name = str
+		case "version":
+			typedData.Domain.Version = str
+		case "chainId":
+			var chainID math.HexOrDecimal256
+			if err := chainID.UnmarshalText([]byte(str)); err != nil {
+				return nil, fmt.Errorf("invalid domain chainId: %v", err)
+			}
+			typedData.Domain.ChainId = &chainID
+		case "verifyingContract":
+			typedData.Domain.VerifyingContract = str
+		case "salt":
+			typedData.Domain.Salt = str
+		default:
+			return nil, fmt.Errorf("unknown domain field %s", key)
+		}
+	}
+
+	// ethers strips EIP712Domain from the types it hands to signers, so
+	// rebuild it from the domain fields that were actually provided.
+	if _, ok := typedData.Types[EIP712Domain]; !ok {
+		typedData.Types[EIP712Domain] = domainType(typedData.Domain)
+	}
+
+	return typedData, nil
+}
+
+// hashTypedData returns the EIP-712 digest along with the domain separator and
+// the struct hash of the primary type
+func hashTypedData(typedData *core.TypedData) (digest []byte, domainSeparator []byte, structHash []byte, err error) {
+	domainSeparator, err = typedData.HashStruct(EIP712Domain, typedData.Domain.Map())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	structHash, err = typedData.HashStruct(typedData.PrimaryType, typedData.Message)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rawData := []byte(fmt.Sprintf("\x19\x01%s%s", string(domainSeparator), string(structHash)))
+	return crypto.Keccak256(rawData), domainSeparator, structHash, nil
+}
+
+// domainType lists the EIP712Domain fields in the order mandated by the spec
+func domainType(domain core.TypedDataDomain) []core.Type {
+	var fields []core.Type
+	if domain.Name != Empty {
+		fields = append(fields, core.Type{Name: "name", Type: "string"})
+	}
+	if domain.Version != Empty {
+		fields = append(fields, core.Type{Name: "version", Type: "string"})
+	}
+	if domain.ChainId != nil {
+		fields = append(fields, core.Type{Name: "chainId", Type: "uint256"})
+	}
+	if domain.VerifyingContract != Empty {
+		fields = append(fields, core.Type{Name: "verifyingContract", Type: "address"})
+	}
+	if domain.Salt != Empty {
+		fields = append(fields, core.Type{Name: "salt", Type: "bytes32"})
+	}
+	return fields
+}
+
+// normalizeTypedValue converts json.Number values into strings, which the
+// go-ethereum typed data encoder parses as decimal or hex integers
+func normalizeTypedValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		return v.String()
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = normalizeTypedValue(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = normalizeTypedValue(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
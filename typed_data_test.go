@@ -0,0 +1,145 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// mailTypedData is the Mail example of EIP-712, without the EIP712Domain type
+// as ethers sends it
+const mailTypedData = `{
+	"types": {
+		"Person": [{"name": "name", "type": "string"}, {"name": "wallet", "type": "address"}],
+		"Mail": [{"name": "from", "type": "Person"}, {"name": "to", "type": "Person"}, {"name": "contents", "type": "string"}]
+	},
+	"primaryType": "Mail",
+	"domain": {
+		"name": "Ether Mail",
+		"version": "1",
+		"chainId": 1,
+		"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+	},
+	"message": {
+		"from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+		"to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+		"contents": "Hello, Bob!"
+	}
+}`
+
+const (
+	mailDomainSeparator = "0xf2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f"
+	mailStructHash      = "0xc52c0ee5d84264471806290a3f2c4cecfc5490626bf912d01f240d7a274b371e"
+	mailDigest          = "0xbe609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2"
+)
+
+// signatureSigner returns the address that produced signature over digest,
+// accepting both recovery id conventions
+func signatureSigner(t *testing.T, digest []byte, signature string) (common.Address, byte) {
+	t.Helper()
+	sig, err := hexutil.Decode(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := sig[crypto.RecoveryIDOffset]
+	if v >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	publicKey, err := crypto.SigToPub(digest, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crypto.PubkeyToAddress(*publicKey), v
+}
+
+func TestHashTypedDataMail(t *testing.T) {
+	typedData, err := parseTypedData(mailTypedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, domainSeparator, structHash, err := hashTypedData(typedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range map[string]struct {
+		got  []byte
+		want string
+	}{
+		"domain separator": {domainSeparator, mailDomainSeparator},
+		"struct hash":      {structHash, mailStructHash},
+		"digest":           {digest, mailDigest},
+	} {
+		if hexutil.Encode(c.got) != c.want {
+			t.Fatalf("expected %s %s, got %s", name, c.want, hexutil.Encode(c.got))
+		}
+	}
+}
+
+func TestParseTypedDataRejectsInvalidPayloads(t *testing.T) {
+	for _, raw := range []string{
+		``,
+		`not json`,
+		`{"types": {"Mail": []}, "domain": {}, "message": {}}`,
+		`{"types": {"Mail": []}, "primaryType": "Other", "domain": {}, "message": {}}`,
+		`{"types": {"Mail": []}, "primaryType": "Mail", "domain": {"owner": "me"}, "message": {}}`,
+	} {
+		if _, err := parseTypedData(raw); err == nil {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestSignTypedData(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+
+	resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/sign-typed-data", map[string]interface{}{
+		"typed_data": mailTypedData,
+	}))
+	if resp.Data["digest"] != mailDigest || resp.Data["domainSeparator"] != mailDomainSeparator {
+		t.Fatalf("expected the digest of the Mail example, got %v", resp.Data)
+	}
+	if resp.Data["address"] != testAddress {
+		t.Fatalf("expected address %s, got %v", testAddress, resp.Data["address"])
+	}
+	signer, v := signatureSigner(t, hexutil.MustDecode(mailDigest), resp.Data["signature"].(string))
+	if signer.Hex() != testAddress || v > 1 {
+		t.Fatalf("expected a 0/1 signature by %s, got v %d by %s", testAddress, v, signer.Hex())
+	}
+
+	resp = mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/sign-typed-data", map[string]interface{}{
+		"typed_data": mailTypedData,
+		"legacy_v":   true,
+	}))
+	if signer, v := signatureSigner(t, hexutil.MustDecode(mailDigest), resp.Data["signature"].(string)); signer.Hex() != testAddress || v < 27 {
+		t.Fatalf("expected a 27/28 signature by %s, got v %d by %s", testAddress, v, signer.Hex())
+	}
+
+	mustFail(t, request(t, b, s, logical.UpdateOperation, "accounts/test/sign-typed-data", map[string]interface{}{
+		"typed_data": `{"primaryType": "Mail"}`,
+	}))
+}
+
+func TestSignMessageRecoveryID(t *testing.T) {
+	b, s := getTestBackend(t)
+	createTestAccount(t, b, s, "test")
+	hash := accounts.TextHash([]byte("hello"))
+
+	for legacyV, valid := range map[bool]func(byte) bool{
+		false: func(v byte) bool { return v <= 1 },
+		true:  func(v byte) bool { return v == 27 || v == 28 },
+	} {
+		resp := mustSucceed(t, request(t, b, s, logical.UpdateOperation, "accounts/test/sign", map[string]interface{}{
+			"message":  "hello",
+			"legacy_v": legacyV,
+		}))
+		signer, v := signatureSigner(t, hash, resp.Data["signature"].(string))
+		if signer.Hex() != testAddress || !valid(v) {
+			t.Fatalf("legacy_v=%t: unexpected v %d by %s", legacyV, v, signer.Hex())
+		}
+	}
+}
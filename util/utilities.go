@@ -30,6 +30,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/keystore"
@@ -293,8 +294,56 @@ func EncryptKey(key *ecdsa.PrivateKey, address *common.Address, id uuid.UUID, au
 	return json.Marshal(encryptedKeyJSONV3)
 }
 
-// ImportJSONKeystore decrypts a JSON keystore given a passphrase
+// pbkdf2MaxIterations caps the iterations of an imported pbkdf2 keystore, as
+// geth writes them
+const pbkdf2MaxIterations = 262144
+
+// checkKDFParams rejects a JSON keystore whose key derivation costs more than
+// the standard scrypt parameters, so that decrypting it cannot exhaust memory
+// or CPU. scrypt needs 128*n*r bytes and n*r*p work, so the light parameters
+// of geth (a small n with p=6) are accepted.
+func checkKDFParams(keystoreBytes []byte) error {
+	var header struct {
+		Crypto struct {
+			KDF       string                 `json:"kdf"`
+			KDFParams map[string]interface{} `json:"kdfparams"`
+		} `json:"crypto"`
+	}
+	if err := json.Unmarshal(keystoreBytes, &header); err != nil {
+		return err
+	}
+	param := func(name string) float64 {
+		value, _ := header.Crypto.KDFParams[name].(float64)
+		return value
+	}
+	if param("dklen") > scryptDKLen {
+		return fmt.Errorf("keystore dklen exceeds %d", scryptDKLen)
+	}
+	switch header.Crypto.KDF {
+	case keyHeaderKDF:
+		if param("n") > keystore.StandardScryptN {
+			return fmt.Errorf("keystore scrypt n exceeds %d", keystore.StandardScryptN)
+		}
+		if param("r") > scryptR {
+			return fmt.Errorf("keystore scrypt r exceeds %d", scryptR)
+		}
+		if param("n")*param("r")*param("p") > keystore.StandardScryptN*scryptR*keystore.StandardScryptP {
+			return fmt.Errorf("keystore scrypt cost n*r*p exceeds %d", keystore.StandardScryptN*scryptR*keystore.StandardScryptP)
+		}
+	case "pbkdf2":
+		if param("c") > pbkdf2MaxIterations {
+			return fmt.Errorf("keystore pbkdf2 iterations exceed %d", pbkdf2MaxIterations)
+		}
+	}
+	return nil
+}
+
+// ImportJSONKeystore decrypts a JSON keystore given a passphrase. Keystores
+// with key derivation parameters above the standard ones are refused.
 func ImportJSONKeystore(keystoreBytes []byte, passphrase string) (*ecdsa.PrivateKey, error) {
+	if err := checkKDFParams(keystoreBytes); err != nil {
+		return nil, err
+	}
 	var key *keystore.Key
 	key, err := keystore.DecryptKey(keystoreBytes, passphrase)
 	if err != nil {
@@ -333,13 +382,33 @@ func WriteKeyFile(file string, content []byte) error {
 
 // TokenAmount does the requisite math on tokens
 func TokenAmount(amount int64, decimals uint8) *big.Int {
-	var bigDecimal big.Int
-	bigDecimal.SetString(fmt.Sprintf("%d", decimals), 10)
-	power := Pow(10, bigDecimal.Int64())
+	power := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	return power.Mul(power, big.NewInt(amount))
+}
 
-	var bigPower, _ = new(big.Int).SetString(fmt.Sprintf("%d", power), 10)
-	var bigAmount, _ = new(big.Int).SetString(fmt.Sprintf("%d", amount), 10)
+// ParseTokenAmount converts a human readable token amount such as "12.5" into
+// base units for a token with the given decimals
+func ParseTokenAmount(amount string, decimals uint8) (*big.Int, error) {
+	whole, fraction := amount, ""
+	if i := strings.IndexByte(amount, '.'); i >= 0 {
+		whole, fraction = amount[:i], amount[i+1:]
+	}
+	if whole == "" && fraction == "" {
+		return nil, fmt.Errorf("invalid amount %s", amount)
+	}
+	if len(fraction) > int(decimals) {
+		return nil, fmt.Errorf("amount %s has more than %d decimals", amount, decimals)
+	}
 
-	var bigProduct = new(big.Int)
-	return bigProduct.Mul(bigPower, bigAmount)
+	digits := whole + fraction + strings.Repeat("0", int(decimals)-len(fraction))
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return nil, fmt.Errorf("invalid amount %s", amount)
+		}
+	}
+	result, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %s", amount)
+	}
+	return result, nil
 }